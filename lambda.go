@@ -3,14 +3,19 @@ package main
 // BUILD: docker run --rm -it -v `pwd`:/app amazonlinux bash -c "yum -y install go && cd /app && go build lambda.go"
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"log"
+	"net/http"
+	"net/url"
 	"os"
 	spbot "spbot/src"
 	srclambda "spbot/srclambda"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
@@ -19,15 +24,184 @@ type spreadsheetBotEvent struct {
 	Ts           string `json:"timestamp"`
 	Overlap      bool   `json:"overlap"`
 	FilterGroups string `json:"filterGroups"`
+	Seed         int64  `json:"seed"`
+	PlanOut      string `json:"planOut"`
+	ApplyPlan    string `json:"applyPlan"`
+	Format       string `json:"format"`
+	Verbose      bool   `json:"verbose"`
+	// SlackRequest - Slack request handed over by handleSlackRequest, its task runs in this invocation
+	SlackRequest *slackRequest `json:"slackRequest"`
 }
 
-func handleLambdaEvent(event spreadsheetBotEvent) error {
+type slackRequest struct {
+	Headers map[string]string `json:"headers"`
+	Body    []byte            `json:"body"`
+}
+
+func createContext() (*spbot.RuntimeContext, error) {
 	io := srclambda.SSMIOStrategy{
 		KeyPrefix: os.Getenv("SSM_KEY_PREFIX"),
 	}
-	ctx := spbot.CreateContext("config", &io)
+	ctx, err := spbot.CreateContext("config", &io)
+	if err != nil {
+		return nil, err
+	}
+	// state files (PagerDuty directory cache and history, synced calendar events, sent handoffs) do not fit
+	// into SSM parameters, they are kept in S3 bucket when configured and not kept at all otherwise
+	if bucket := os.Getenv("STATE_BUCKET"); bucket != "" {
+		spbot.SetStateStorage(ctx, &srclambda.S3IOStrategy{Bucket: bucket, KeyPrefix: os.Getenv("STATE_KEY_PREFIX")})
+	} else {
+		spbot.SetStateStorage(ctx, nil)
+	}
+	return ctx, nil
+}
+
+// handleSlackRequest handles Slack requests passed by API Gateway, Lambda cannot continue work
+// after response is returned, so task is handed over to asynchronous invocation of the same function
+func handleSlackRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	ctx, err := createContext()
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	if strings.HasPrefix(request.Path, "/ical/") {
+		return handleICalRequest(ctx, request)
+	}
+	if strings.HasPrefix(request.Path, "/groups") || strings.HasPrefix(request.Path, "/people/") {
+		return handleAPIRequest(ctx, request)
+	}
+
+	header := make(http.Header)
+	for k, v := range request.Headers {
+		header.Set(k, v)
+	}
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		body, err = base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest}, nil
+		}
+	}
+
+	response := spbot.HandleSlackRequest(ctx, header, body)
+	if response.Task != nil {
+		payload, err := json.Marshal(spreadsheetBotEvent{
+			Cmd:          "slackTask",
+			SlackRequest: &slackRequest{Headers: request.Headers, Body: body},
+		})
+		if err == nil {
+			err = srclambda.InvokeSelfAsync(payload)
+		}
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: response.Status,
+		Body:       string(response.Body),
+		Headers:    map[string]string{"Content-Type": "application/json"},
+	}, nil
+}
+
+// handleSlackTask performs task of Slack request handed over by handleSlackRequest, request is
+// verified again as the payload is only as trustworthy as whoever invoked the function
+func handleSlackTask(request *slackRequest) error {
+	ctx, err := createContext()
+	if err != nil {
+		return err
+	}
+	ctx.Command = "slackTask"
+	header := make(http.Header)
+	for k, v := range request.Headers {
+		header.Set(k, v)
+	}
+	response := spbot.HandleSlackRequest(ctx, header, request.Body)
+	if response.Task == nil {
+		return fmt.Errorf("Slack request has no task, status %d", response.Status)
+	}
+	err = spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack)
+	if err != nil {
+		return err
+	}
+	response.Task()
+	return nil
+}
+
+// handleICalRequest serves calendar feeds passed by API Gateway
+func handleICalRequest(ctx *spbot.RuntimeContext, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	query := make(url.Values)
+	for k, v := range request.QueryStringParameters {
+		query.Set(k, v)
+	}
+	err := spbot.LoadSheets(ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	response := spbot.HandleICalRequest(ctx, request.Path, query)
+	return events.APIGatewayProxyResponse{
+		StatusCode: response.Status,
+		Body:       string(response.Body),
+		Headers:    map[string]string{"Content-Type": "text/calendar; charset=utf-8"},
+	}, nil
+}
+
+// handleAPIRequest serves read-only schedule API passed by API Gateway
+func handleAPIRequest(ctx *spbot.RuntimeContext, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	query := make(url.Values)
+	for k, v := range request.QueryStringParameters {
+		query.Set(k, v)
+	}
+	header := make(http.Header)
+	for k, v := range request.Headers {
+		header.Set(k, v)
+	}
+	loaders := []func(*spbot.RuntimeContext) error{spbot.LoadSheets}
+	// only person assignments carry Slack and PagerDuty IDs
+	if strings.HasPrefix(request.Path, "/people/") {
+		loaders = append(loaders, spbot.LoadUserDirectories)
+	}
+	if err := spbot.Load(ctx, loaders...); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	response := spbot.HandleAPIRequest(ctx, request.HTTPMethod, request.Path, query, header)
+	return events.APIGatewayProxyResponse{
+		StatusCode: response.Status,
+		Body:       string(response.Body),
+		Headers:    map[string]string{"Content-Type": "application/json"},
+	}, nil
+}
+
+func handleLambdaRequest(raw json.RawMessage) (interface{}, error) {
+	var probe struct {
+		RequestContext json.RawMessage `json:"requestContext"`
+	}
+	if err := json.Unmarshal(raw, &probe); err == nil && probe.RequestContext != nil {
+		var request events.APIGatewayProxyRequest
+		if err := json.Unmarshal(raw, &request); err != nil {
+			return nil, err
+		}
+		return handleSlackRequest(request)
+	}
+
+	var event spreadsheetBotEvent
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return nil, err
+	}
+	if event.SlackRequest != nil {
+		return nil, handleSlackTask(event.SlackRequest)
+	}
+	return nil, handleLambdaEvent(event)
+}
+
+func handleLambdaEvent(event spreadsheetBotEvent) error {
+	ctx, err := createContext()
+	if err != nil {
+		return err
+	}
+	ctx.Command = event.Cmd
+	ctx.Verbose = event.Verbose
 
-	fmt.Println("Running command", event.Cmd, ", TS=", event.Ts, ", Overlap=", event.Overlap, ", FilterGroups=", event.FilterGroups)
+	spbot.LogInfo(ctx, "Running command, TS=%s, Overlap=%t, FilterGroups=%s", event.Ts, event.Overlap, event.FilterGroups)
 	ts := time.Now()
 	if event.Ts != "" {
 		i, err := strconv.ParseInt(event.Ts, 10, 64)
@@ -45,6 +219,15 @@ func handleLambdaEvent(event spreadsheetBotEvent) error {
 		ctx.FilterGroups = event.FilterGroups
 	}
 
+	ctx.Seed = event.Seed
+	ctx.PlanOut = event.PlanOut
+	ctx.Format = event.Format
+	if !spbot.ValidScheduleFormat(ctx.Format) {
+		return fmt.Errorf("Unknown format %s", ctx.Format)
+	}
+	// there is nobody to answer prompt in Lambda, invocation itself is the confirmation
+	ctx.AssumeYes = true
+
 	var (
 		startDate time.Time
 		endDate   time.Time
@@ -52,13 +235,13 @@ func handleLambdaEvent(event spreadsheetBotEvent) error {
 	)
 
 	switch event.Cmd {
-	case "printSchedule", "notifySlack", "assignPagerDuty":
+	case "printSchedule", "notifySlack", "assignPagerDuty", "verifyPagerDutySchedule", "assignOpsgenie":
 		startDate = ts.In(time.UTC).Truncate(7 * 24 * time.Hour)
-		endDate = startDate.AddDate(0, 0, 5)
+		endDate = startDate.AddDate(0, 0, 7)
 		title = "schedule for this week"
-	case "printScheduleNextWeek", "notifySlackNextWeek", "assignPagerDutyNextWeek":
+	case "printScheduleNextWeek", "notifySlackNextWeek", "assignPagerDutyNextWeek", "verifyPagerDutyScheduleNextWeek", "assignOpsgenieNextWeek":
 		startDate = ts.In(time.UTC).Truncate(7*24*time.Hour).AddDate(0, 0, 7)
-		endDate = startDate.AddDate(0, 0, 5)
+		endDate = startDate.AddDate(0, 0, 7)
 		title = "schedule for next week"
 	case "printScheduleToday", "notifySlackToday":
 		startDate = ts.In(time.UTC).Truncate(24 * time.Hour)
@@ -68,38 +251,119 @@ func handleLambdaEvent(event spreadsheetBotEvent) error {
 
 	switch event.Cmd {
 	case "printSchedule", "printScheduleNextWeek", "printScheduleToday":
-		spbot.LoadSheets(ctx)
-		spbot.LoadSlack(ctx)
-		spbot.PrintScheduleForDateRange(ctx, startDate, endDate, title)
+		if err := spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack); err != nil {
+			return err
+		}
+		if ctx.Format != "" && ctx.Format != "text" && ctx.PagerDutyToken != "" {
+			if err := spbot.LoadPagerduty(ctx); err != nil {
+				return err
+			}
+		}
+		if err := spbot.PrintScheduleForDateRange(ctx, startDate, endDate, title); err != nil {
+			return err
+		}
 	case "notifySlack", "notifySlackNextWeek", "notifySlackToday":
-		spbot.LoadSheets(ctx)
-		spbot.LoadSlack(ctx)
+		if err := spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack); err != nil {
+			return err
+		}
 		spbot.NotifySlackOfScheduleForDateRange(ctx, startDate, endDate, title)
 	case "assignGroups":
-		spbot.LoadSheets(ctx)
-		spbot.LoadSlack(ctx)
+		if err := spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack, spbot.LoadPagerDutyOnCall); err != nil {
+			return err
+		}
 		spbot.PerformAssign(ctx, time.Now())
+	case "notifyHandoff":
+		if err := spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack, spbot.LoadPagerDutyOnCall); err != nil {
+			return err
+		}
+		spbot.NotifyHandoff(ctx, ts)
+	case "publishHome":
+		if err := spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack); err != nil {
+			return err
+		}
+		spbot.PublishHome(ctx, ts)
+	case "exportICal":
+		bucket := os.Getenv("ICAL_BUCKET")
+		if bucket == "" {
+			return fmt.Errorf("ICAL_BUCKET is required to export calendar feeds")
+		}
+		if err := spbot.LoadSheets(ctx); err != nil {
+			return err
+		}
+		spbot.ExportICalendar(ctx, &srclambda.S3IOStrategy{Bucket: bucket, KeyPrefix: os.Getenv("ICAL_KEY_PREFIX")}, ts)
+	case "publishDashboard":
+		bucket := os.Getenv("DASHBOARD_BUCKET")
+		if bucket == "" {
+			return fmt.Errorf("DASHBOARD_BUCKET is required to publish dashboard")
+		}
+		if err := spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack, spbot.LoadPagerDutyOnCall); err != nil {
+			return err
+		}
+		spbot.PublishDashboard(ctx, &srclambda.S3IOStrategy{Bucket: bucket, KeyPrefix: os.Getenv("DASHBOARD_KEY_PREFIX")}, ts)
+	case "syncCalendar":
+		if err := spbot.Load(ctx, spbot.LoadSheets, spbot.LoadCalendar); err != nil {
+			return err
+		}
+		spbot.SyncCalendar(ctx, ts)
+	case "scheduleReminders":
+		if err := spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack); err != nil {
+			return err
+		}
+		spbot.ScheduleReminders(ctx, ts)
 	case "assignPagerDuty", "assignPagerDutyNextWeek":
-		fmt.Println("Loading PD")
-		spbot.LoadPagerduty(ctx)
-		fmt.Println("Loading Sheets")
-		spbot.LoadSheets(ctx)
+		spbot.LogInfo(ctx, "Loading PagerDuty")
+		if err := spbot.LoadPagerduty(ctx); err != nil {
+			return err
+		}
+		spbot.LogInfo(ctx, "Loading Sheets")
+		if err := spbot.LoadSheets(ctx); err != nil {
+			return err
+		}
 		spbot.PagerDutyAssignTiers(ctx, startDate, endDate)
+	case "applyPagerDutyPlan":
+		if err := spbot.LoadPagerduty(ctx); err != nil {
+			return err
+		}
+		spbot.ApplyPagerDutyPlan(ctx, event.ApplyPlan)
+	case "pagerDutyCleanup":
+		if err := spbot.LoadPagerduty(ctx); err != nil {
+			return err
+		}
+		spbot.PagerDutyCleanup(ctx)
+	case "assignOpsgenie", "assignOpsgenieNextWeek":
+		if err := spbot.Load(ctx, spbot.LoadOpsgenie, spbot.LoadSheets); err != nil {
+			return err
+		}
+		spbot.OpsgenieAssign(ctx, startDate, endDate)
+	case "verifyOpsgenieNames":
+		if err := spbot.Load(ctx, spbot.LoadSheets, spbot.LoadOpsgenie); err != nil {
+			return err
+		}
+		spbot.VerifyOpsgenieNames(ctx)
 	case "verifySlackNames":
-		spbot.LoadSheets(ctx)
-		spbot.LoadSlack(ctx)
+		if err := spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack); err != nil {
+			return err
+		}
 		spbot.VerifySlackNames(ctx)
 	case "verifyPagerDutyNames":
-		spbot.LoadSheets(ctx)
-		spbot.LoadPagerduty(ctx)
+		if err := spbot.Load(ctx, spbot.LoadSheets, spbot.LoadPagerduty); err != nil {
+			return err
+		}
 		spbot.VerifyPagerDutyNames(ctx)
+	case "verifyPagerDutySchedule", "verifyPagerDutyScheduleNextWeek":
+		if err := spbot.Load(ctx, spbot.LoadSheets, spbot.LoadPagerduty); err != nil {
+			return err
+		}
+		if problems := spbot.VerifyPagerDutySchedule(ctx, startDate, endDate); problems > 0 {
+			return fmt.Errorf("PagerDuty on-call does not match spreadsheet, %d problem(s) found", problems)
+		}
 	default:
-		log.Fatalln("No command specified")
+		return fmt.Errorf("Unknown command '%s'", event.Cmd)
 	}
 
 	return nil
 }
 
 func main() {
-	lambda.Start(handleLambdaEvent)
+	lambda.Start(handleLambdaRequest)
 }
@@ -2,10 +2,43 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"os"
 	spbot "spbot/src"
 	"time"
 )
 
+// optionFlags - flags modifying commands, every other flag is a command
+var optionFlags = map[string]bool{
+	"config":       true,
+	"metrics":      true,
+	"plan-out":     true,
+	"filterGroups": true,
+	"format":       true,
+	"seed":         true,
+	"verbose":      true,
+	"yes":          true,
+	"overlap":      true,
+}
+
+// commandFlag returns name of the command given on command line, it is added to every log line
+func commandFlag() string {
+	command := ""
+	flag.Visit(func(f *flag.Flag) {
+		if command == "" && !optionFlags[f.Name] {
+			command = f.Name
+		}
+	})
+	return command
+}
+
+// must ends the run on error, metrics of the run are saved before exit
+func must(ctx *spbot.RuntimeContext, err error) {
+	if err != nil {
+		spbot.Fatal(ctx, err)
+	}
+}
+
 func main() {
 	configFile := flag.String("config", "config.json", "config file")
 
@@ -19,22 +52,59 @@ func main() {
 	notifySlackToday := flag.Bool("notifySlackToday", false, "notify Slack channels about schedule for today")
 	notifySlackNextWeek := flag.Bool("notifySlackNextWeek", false, "notify Slack channels about schedule for next week")
 
+	notifyHandoff := flag.Bool("notifyHandoff", false, "notify about handoff between yesterday's and today's people without assigning Slack groups")
+	publishHome := flag.Bool("publishHome", false, "publish Slack App Home for everybody in upcoming schedules")
+	serve := flag.String("serve", "", "run HTTP server handling Slack events and calendar feeds on given address (eg. :8080)")
+	serveAPI := flag.String("serveAPI", "", "run read-only HTTP API with schedules on given address (eg. :8081)")
+	metricsAddr := flag.String("metrics", "", "expose Prometheus /metrics on given address (eg. :9090), -serve and -serveAPI expose it on their own")
+	socketMode := flag.Bool("socketMode", false, "run daemon handling Slack events over Socket Mode websocket")
+	exportICal := flag.Bool("exportICal", false, "save iCalendar feeds of every group and person (2 weeks back, 8 weeks ahead)")
+	publishDashboard := flag.Bool("publishDashboard", false, "write dashboard.html with schedules of upcoming weeks")
+	syncCalendar := flag.Bool("syncCalendar", false, "create, update and delete Google Calendar events of upcoming assignments")
+	scheduleReminders := flag.Bool("scheduleReminders", false, "schedule Slack reminders about upcoming shifts")
+
 	assignPagerDuty := flag.Bool("assignPagerDuty", false, "assign PagerDuty for this week")
 	assignPagerDutyNextWeek := flag.Bool("assignPagerDutyNextWeek", false, "assign PagerDuty for next week")
+	pagerDutyCleanup := flag.Bool("pagerDutyCleanup", false, "remove orphaned generated PagerDuty Slot_ schedules of configured policies")
+	assignOpsgenie := flag.Bool("assignOpsgenie", false, "assign Opsgenie schedules and escalations for this week")
+	assignOpsgenieNextWeek := flag.Bool("assignOpsgenieNextWeek", false, "assign Opsgenie schedules and escalations for next week")
+	verifyOpsgenieNames := flag.Bool("verifyOpsgenieNames", false, "verify Opsgenie <-> spreadsheet names")
 	verifySlackNames := flag.Bool("verifySlackNames", false, "verify Slack <-> spreadsheet names")
 	verifyPagerDutyNames := flag.Bool("verifyPagerDutyNames", false, "verify PagerDuty <-> spreadsheet names")
+	verifyPagerDutySchedule := flag.Bool("verifyPagerDutySchedule", false, "verify live PagerDuty on-call against spreadsheet for this week (exit code 1 on mismatch)")
+	verifyPagerDutyScheduleNextWeek := flag.Bool("verifyPagerDutyScheduleNextWeek", false, "verify live PagerDuty on-call against spreadsheet for next week (exit code 1 on mismatch)")
+
+	applyPlan := flag.String("apply-plan", "", "apply PagerDuty plan saved with -plan-out exactly as saved")
 
-	verbose := flag.Bool("verbose", true, "increase output verbosity")
+	verbose := flag.Bool("verbose", false, "log debug lines including stack traces of errors")
+	yes := flag.Bool("yes", false, "apply PagerDuty changes without asking for confirmation")
+	planOut := flag.String("plan-out", "", "write planned PagerDuty layout to file instead of applying it (only assignPagerDuty*)")
 
 	filterGroups := flag.String("filterGroups", "", "filter groups to process (only assignGroups and printSchedule*)")
 	overlap := flag.Bool("overlap", false, "overlap groups with next day (only assignGroups and printSchedule*)")
+	format := flag.String("format", "text", "output format of printSchedule*: text, json, csv, markdown, html or yaml")
+	seed := flag.Int64("seed", 0, "seed for tie-breaking PagerDuty tier placement (only assignPagerDuty*)")
 
 	flag.Parse()
 	io := spbot.CliIOStrategy{}
-	ctx := spbot.CreateContext(*configFile, &io)
+	ctx, err := spbot.CreateContext(*configFile, &io)
+	must(nil, err)
 	ctx.Verbose = *verbose
+	ctx.Command = commandFlag()
 	ctx.Overlap = *overlap
 	ctx.FilterGroups = *filterGroups
+	ctx.Seed = *seed
+	ctx.AssumeYes = *yes
+	ctx.PlanOut = *planOut
+	ctx.Format = *format
+	// metrics of this run are stored when -serve, -serveAPI or -metrics sharing the directory exposes them
+	defer spbot.SaveMetrics(ctx)
+	if *metricsAddr != "" {
+		must(ctx, spbot.ServeMetrics(ctx, *metricsAddr))
+	}
+	if !spbot.ValidScheduleFormat(ctx.Format) {
+		must(ctx, fmt.Errorf("Unknown format %s", ctx.Format))
+	}
 
 	var (
 		startDate time.Time
@@ -42,15 +112,15 @@ func main() {
 		title     string
 	)
 
-	if *printSchedule || *notifySlack || *assignPagerDuty {
+	if *printSchedule || *notifySlack || *assignPagerDuty || *verifyPagerDutySchedule || *assignOpsgenie {
 		startDate = time.Now().In(time.UTC).Truncate(7 * 24 * time.Hour)
-		endDate = startDate.AddDate(0, 0, 5)
+		endDate = startDate.AddDate(0, 0, 7)
 		title = "schedule for this week"
 	}
 
-	if *printScheduleNextWeek || *notifySlackNextWeek || *assignPagerDutyNextWeek {
+	if *printScheduleNextWeek || *notifySlackNextWeek || *assignPagerDutyNextWeek || *verifyPagerDutyScheduleNextWeek || *assignOpsgenieNextWeek {
 		startDate = time.Now().In(time.UTC).Truncate(7*24*time.Hour).AddDate(0, 0, 7)
-		endDate = startDate.AddDate(0, 0, 5)
+		endDate = startDate.AddDate(0, 0, 7)
 		title = "schedule for next week"
 	}
 
@@ -61,46 +131,133 @@ func main() {
 	}
 
 	if *printSchedule || *printScheduleNextWeek || *printScheduleToday {
-		spbot.LoadSheets(ctx)
-		spbot.LoadSlack(ctx)
-		spbot.PrintScheduleForDateRange(ctx, startDate, endDate, title)
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack))
+		// PagerDuty IDs are part of machine-readable formats only
+		if ctx.Format != "text" && ctx.PagerDutyToken != "" {
+			must(ctx, spbot.LoadPagerduty(ctx))
+		}
+		must(ctx, spbot.PrintScheduleForDateRange(ctx, startDate, endDate, title))
 		return
 	}
 
 	if *notifySlack || *notifySlackNextWeek || *notifySlackToday {
-		spbot.LoadSheets(ctx)
-		spbot.LoadSlack(ctx)
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack))
 		spbot.NotifySlackOfScheduleForDateRange(ctx, startDate, endDate, title)
 		return
 	}
 
 	if *assignGroups {
-		spbot.LoadSheets(ctx)
-		spbot.LoadSlack(ctx)
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack, spbot.LoadPagerDutyOnCall))
 		spbot.PerformAssign(ctx, time.Now())
 		return
 	}
 
+	if *notifyHandoff {
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack, spbot.LoadPagerDutyOnCall))
+		spbot.NotifyHandoff(ctx, time.Now())
+		return
+	}
+
+	if *publishHome {
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack))
+		spbot.PublishHome(ctx, time.Now())
+		return
+	}
+
+	if *serve != "" {
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack))
+		must(ctx, spbot.Serve(ctx, *serve))
+		return
+	}
+
+	if *serveAPI != "" {
+		// users are loaded once, so person assignments carry Slack and PagerDuty IDs
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadUserDirectories))
+		must(ctx, spbot.ServeAPI(ctx, *serveAPI))
+		return
+	}
+
+	if *socketMode {
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack))
+		must(ctx, spbot.RunSocketMode(ctx))
+		return
+	}
+
+	if *exportICal {
+		must(ctx, spbot.LoadSheets(ctx))
+		spbot.ExportICalendar(ctx, &io, time.Now())
+		return
+	}
+
+	if *publishDashboard {
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack, spbot.LoadPagerDutyOnCall))
+		spbot.PublishDashboard(ctx, &io, time.Now())
+		return
+	}
+
+	if *syncCalendar {
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadCalendar))
+		spbot.SyncCalendar(ctx, time.Now())
+		return
+	}
+
+	if *scheduleReminders {
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack))
+		spbot.ScheduleReminders(ctx, time.Now())
+		return
+	}
+
 	if *assignPagerDuty || *assignPagerDutyNextWeek {
-		spbot.LoadPagerduty(ctx)
-		spbot.LoadSheets(ctx)
+		must(ctx, spbot.Load(ctx, spbot.LoadPagerduty, spbot.LoadSheets))
 		spbot.PagerDutyAssignTiers(ctx, startDate, endDate)
 		return
 	}
 
+	if *applyPlan != "" {
+		must(ctx, spbot.LoadPagerduty(ctx))
+		spbot.ApplyPagerDutyPlan(ctx, *applyPlan)
+		return
+	}
+
+	if *pagerDutyCleanup {
+		must(ctx, spbot.LoadPagerduty(ctx))
+		spbot.PagerDutyCleanup(ctx)
+		return
+	}
+
+	if *assignOpsgenie || *assignOpsgenieNextWeek {
+		must(ctx, spbot.Load(ctx, spbot.LoadOpsgenie, spbot.LoadSheets))
+		spbot.OpsgenieAssign(ctx, startDate, endDate)
+		return
+	}
+
+	if *verifyOpsgenieNames {
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadOpsgenie))
+		spbot.VerifyOpsgenieNames(ctx)
+		return
+	}
+
 	if *verifySlackNames {
-		spbot.LoadSheets(ctx)
-		spbot.LoadSlack(ctx)
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadSlack))
 		spbot.VerifySlackNames(ctx)
 		return
 	}
 
 	if *verifyPagerDutyNames {
-		spbot.LoadSheets(ctx)
-		spbot.LoadPagerduty(ctx)
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadPagerduty))
 		spbot.VerifyPagerDutyNames(ctx)
 		return
 	}
 
+	if *verifyPagerDutySchedule || *verifyPagerDutyScheduleNextWeek {
+		must(ctx, spbot.Load(ctx, spbot.LoadSheets, spbot.LoadPagerduty))
+		if spbot.VerifyPagerDutySchedule(ctx, startDate, endDate) > 0 {
+			// deferred functions do not run on exit
+			spbot.SaveMetrics(ctx)
+			os.Exit(1)
+		}
+		return
+	}
+
 	flag.PrintDefaults()
 }
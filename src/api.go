@@ -0,0 +1,214 @@
+package src
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+const (
+	apiDateLayout            = "2006-01-02"
+	apiDefaultScheduleDays   = 7
+	apiDefaultAssignmentDays = 28
+	apiMaxDays               = 366
+)
+
+type apiGroup struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+type apiPerson struct {
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+	Email string `json:"email,omitempty"`
+}
+
+type apiDay struct {
+	Date   string      `json:"date"`
+	People []apiPerson `json:"people"`
+}
+
+type apiSchedule struct {
+	Group string   `json:"group"`
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Days  []apiDay `json:"days"`
+}
+
+type apiAssignments struct {
+	Name        string           `json:"name"`
+	From        string           `json:"from"`
+	To          string           `json:"to"`
+	Assignments []scheduleRecord `json:"assignments"`
+}
+
+func apiJSON(status int, value interface{}) *HTTPResponse {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return &HTTPResponse{Status: http.StatusInternalServerError}
+	}
+	return &HTTPResponse{Status: status, Body: body}
+}
+
+func apiError(status int, message string) *HTTPResponse {
+	return apiJSON(status, map[string]string{"error": message})
+}
+
+// apiDateRange parses from/to (inclusive) query parameters, from defaults to today
+func apiDateRange(query url.Values, now time.Time, defaultDays int) (time.Time, time.Time, error) {
+	from := now.In(time.UTC).Truncate(24 * time.Hour)
+	var err error
+	if value := query.Get("from"); value != "" {
+		from, err = time.Parse(apiDateLayout, value)
+		if err != nil {
+			return from, from, errors.Errorf("Invalid 'from' date '%s', YYYY-MM-DD expected", value)
+		}
+	}
+	to := from.AddDate(0, 0, defaultDays-1)
+	if value := query.Get("to"); value != "" {
+		to, err = time.Parse(apiDateLayout, value)
+		if err != nil {
+			return from, to, errors.Errorf("Invalid 'to' date '%s', YYYY-MM-DD expected", value)
+		}
+	}
+	if to.Before(from) {
+		return from, to, errors.Errorf("'to' date is before 'from' date")
+	}
+	if to.Sub(from) >= apiMaxDays*24*time.Hour {
+		return from, to, errors.Errorf("Range is limited to %d days", apiMaxDays)
+	}
+	return from, to, nil
+}
+
+func findGroupConfig(ctx *RuntimeContext, name string) *AssignmentsConfig {
+	for _, cfg := range ctx.Configs {
+		if strings.EqualFold(cfg.GroupName, name) {
+			return cfg
+		}
+	}
+	return nil
+}
+
+// HandleAPIRequest - serves read-only JSON API: /groups, /groups/<name>/schedule and /people/<name>/assignments,
+// requires "Authorization: Bearer <apiToken>" header when apiToken is configured
+func HandleAPIRequest(ctx *RuntimeContext, method, path string, query url.Values, header http.Header) *HTTPResponse {
+	if ctx.APIToken != "" {
+		token := strings.TrimPrefix(header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(ctx.APIToken)) != 1 {
+			return apiError(http.StatusUnauthorized, "Missing or invalid bearer token")
+		}
+	}
+	if method != http.MethodGet {
+		return apiError(http.StatusMethodNotAllowed, "Only GET is supported")
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "groups":
+		groups := make([]apiGroup, 0, len(ctx.Configs))
+		for _, cfg := range ctx.Configs {
+			source := "spreadsheet"
+			if cfg.PagerDutyOnCall != nil {
+				source = "pagerDutyOnCall"
+			}
+			groups = append(groups, apiGroup{Name: cfg.GroupName, Source: source})
+		}
+		return apiJSON(http.StatusOK, groups)
+	case len(parts) == 3 && parts[0] == "groups" && parts[2] == "schedule":
+		return apiGroupSchedule(ctx, parts[1], query)
+	case len(parts) == 3 && parts[0] == "people" && parts[2] == "assignments":
+		return apiPersonAssignments(ctx, parts[1], query)
+	}
+	return apiError(http.StatusNotFound, "Not found")
+}
+
+func apiGroupSchedule(ctx *RuntimeContext, name string, query url.Values) *HTTPResponse {
+	cfg := findGroupConfig(ctx, name)
+	if cfg == nil {
+		return apiError(http.StatusNotFound, "Unknown group")
+	}
+	if cfg.PagerDutyOnCall != nil {
+		return apiError(http.StatusBadRequest, "Group is taken from PagerDuty on-call, there is no schedule")
+	}
+	from, to, err := apiDateRange(query, time.Now(), apiDefaultScheduleDays)
+	if err != nil {
+		return apiError(http.StatusBadRequest, err.Error())
+	}
+	schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		logError(ctx, cfg.GroupName, err, "Unable to load schedule")
+		return apiError(http.StatusInternalServerError, "Unable to load schedule")
+	}
+	result := apiSchedule{Group: cfg.GroupName, From: from.Format(apiDateLayout), To: to.Format(apiDateLayout)}
+	result.Days = make([]apiDay, 0, len(schedule))
+	for _, entry := range schedule {
+		day := apiDay{Date: entry.Date.Format(apiDateLayout), People: make([]apiPerson, 0, len(entry.Names))}
+		for _, name := range entry.Names {
+			day.People = append(day.People, apiPerson{Name: name.Name, Role: name.Group, Email: name.Email})
+		}
+		result.Days = append(result.Days, day)
+	}
+	return apiJSON(http.StatusOK, result)
+}
+
+func apiPersonAssignments(ctx *RuntimeContext, name string, query url.Values) *HTTPResponse {
+	from, to, err := apiDateRange(query, time.Now(), apiDefaultAssignmentDays)
+	if err != nil {
+		return apiError(http.StatusBadRequest, err.Error())
+	}
+	name = cleanUpName(name)
+	result := apiAssignments{Name: name, From: from.Format(apiDateLayout), To: to.Format(apiDateLayout)}
+	result.Assignments = make([]scheduleRecord, 0)
+	for _, cfg := range calendarGroups(ctx) {
+		schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, from, to.AddDate(0, 0, 1))
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Unable to load schedule")
+			return apiError(http.StatusInternalServerError, "Unable to load schedule")
+		}
+		// only the person is resolved to Slack and PagerDuty IDs, not everybody in the group
+		personSchedule := make([]AssignmentsScheduleEntry, 0, len(schedule))
+		for _, entry := range schedule {
+			names := make([]NameGroup, 0, 1)
+			for _, entryName := range entry.Names {
+				if strings.EqualFold(entryName.Name, name) {
+					names = append(names, entryName)
+				}
+			}
+			if len(names) > 0 {
+				personSchedule = append(personSchedule, AssignmentsScheduleEntry{Date: entry.Date, Names: names})
+			}
+		}
+		result.Assignments = append(result.Assignments, scheduleRecords(ctx, cfg, personSchedule)...)
+	}
+	return apiJSON(http.StatusOK, result)
+}
+
+func apiHandler(ctx *RuntimeContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := HandleAPIRequest(ctx, r.Method, r.URL.Path, r.URL.Query(), r.Header)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(response.Status)
+		w.Write(response.Body)
+	}
+}
+
+// ServeAPI - runs read-only HTTP API with schedules, spreadsheet is cached between requests
+func ServeAPI(ctx *RuntimeContext, addr string) error {
+	err := EnableSpreadsheetCache(ctx)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/groups", apiHandler(ctx))
+	mux.HandleFunc("/groups/", apiHandler(ctx))
+	mux.HandleFunc("/people/", apiHandler(ctx))
+	mux.HandleFunc("/metrics", metricsHandler(ctx))
+	logInfo(ctx, "", "Listening on %s", addr)
+	return errors.Wrap(http.ListenAndServe(addr, mux), 0)
+}
@@ -1,7 +1,6 @@
 package src
 
 import (
-	"log"
 	"strings"
 	"time"
 )
@@ -13,25 +12,47 @@ func PerformAssign(ctx *RuntimeContext, date time.Time) {
 			continue
 		}
 
-		names, err := getCurrentAssignment(ctx, cfg, date)
+		done := startRun(ctx, "assignGroups", cfg.GroupName)
+		day, err := getAssignmentDay(ctx, cfg, date)
 		if err != nil {
-			log.Println("Error while loading assigned people from spreadsheet for group", cfg.GroupName, ":", err)
-			log.Println(Stack(err))
+			logError(ctx, cfg.GroupName, err, "Error while loading assigned people from spreadsheet")
+			done(err)
 			continue
 		}
-		if len(names) == 0 {
+		if len(day.Current) == 0 {
 			// do not clear assignments on keepWhenMissing
 			if cfg.KeepWhenMissing {
+				assignmentSucceeded(ctx, cfg)
+				done(nil)
 				continue
 			} else {
-				log.Println("Warn: No assignment for group", cfg.GroupName)
+				logWarn(ctx, cfg.GroupName, "No assignment")
 			}
 		}
-		err = assignUsersToUserGroups(ctx, names, cfg)
+		err = assignUsersToUserGroups(ctx, cfg, day)
 		if err != nil {
-			log.Println("Error while assigning user group", cfg.GroupName, ":", err)
-			log.Println(Stack(err))
+			logError(ctx, cfg.GroupName, err, "Error while assigning user group")
+			countBackendError(ctx, backendSlack)
+			done(err)
 			continue
 		}
+		assignmentSucceeded(ctx, cfg)
+		done(nil)
+		if cfg.NotifyUsers {
+			notifyAssignments(ctx, cfg, day)
+		}
+		err = sendHandoff(ctx, cfg, day)
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Error while sending handoff")
+			countBackendError(ctx, backendSlack)
+		}
 	}
+
+	if ctx.SlackAppHome {
+		PublishHome(ctx, date)
+	}
+}
+
+func assignmentSucceeded(ctx *RuntimeContext, cfg *AssignmentsConfig) {
+	ctx.metrics.set(metricLastAssignment, map[string]string{"group": cfg.GroupName}, float64(time.Now().Unix()))
 }
@@ -0,0 +1,261 @@
+package src
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+const (
+	calendarEventsFile         = "calendar_events"
+	defaultCalendarWindowDays  = 28
+	calendarGroupProperty      = "spbotGroup"
+	calendarDateProperty       = "spbotDate"
+	calendarEventsDateLayout   = "2006-01-02"
+	calendarSendUpdatesAll     = "all"
+	calendarSendUpdatesNothing = "none"
+)
+
+// calendarEventRef - event created for group and day, hash tells whether it needs update
+type calendarEventRef struct {
+	CalendarID string `json:"calendarID"`
+	EventID    string `json:"eventID"`
+	Hash       string `json:"hash"`
+}
+
+// calendarEvents - stored event references per group and date
+type calendarEvents map[string]map[string]calendarEventRef
+
+// LoadCalendar - Google Calendar client, requires OAuth credentials as API key is read-only
+func LoadCalendar(ctx *RuntimeContext) error {
+	if ctx.GoogleCredentials.ClientID == "" || ctx.GoogleCredentials.ProjectID == "" || ctx.GoogleCredentials.ClientSecret == "" {
+		return errors.Errorf("Google credentials are required to sync calendar events")
+	}
+	config, err := googleOAuthConfig(ctx, calendar.CalendarEventsScope)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	client, err := getClient(ctx, config, calendarTokenName)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	ctx.calendar, err = calendar.NewService(context.Background(), option.WithHTTPClient(client))
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func loadCalendarEvents(ctx *RuntimeContext) calendarEvents {
+	events := make(calendarEvents)
+	data, err := loadState(ctx, calendarEventsFile)
+	if err != nil {
+		return events
+	}
+	if err = json.Unmarshal(data, &events); err != nil {
+		logWarn(ctx, "", "Unable to parse stored calendar events, all events will be created again")
+		return make(calendarEvents)
+	}
+	return events
+}
+
+func saveCalendarEvents(ctx *RuntimeContext, events calendarEvents) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return saveState(ctx, calendarEventsFile, data)
+}
+
+// SyncCalendar - mirrors spreadsheet assignments of the window (starting today) to Google Calendar events
+func SyncCalendar(ctx *RuntimeContext, now time.Time) {
+	// without stored events every run would create all of them again
+	if stateStorage(ctx) == nil {
+		logError(ctx, "", errNoStateStorage, "Unable to sync calendar")
+		return
+	}
+	stored := loadCalendarEvents(ctx)
+	today := now.In(time.UTC).Truncate(24 * time.Hour)
+	for _, cfg := range ctx.Configs {
+		if cfg.Calendar == nil || cfg.PagerDutyOnCall != nil {
+			continue
+		}
+		if len(ctx.FilterGroups) > 0 && !strings.Contains(ctx.FilterGroups, cfg.GroupName) {
+			continue
+		}
+		done := startRun(ctx, "syncCalendar", cfg.GroupName)
+		err := syncGroupCalendar(ctx, cfg, today, stored)
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Unable to sync calendar")
+			countBackendError(ctx, backendGoogleCalendar)
+		}
+		done(err)
+		// events synced so far are stored even when group fails, so they are not duplicated next time
+		err = saveCalendarEvents(ctx, stored)
+		if err != nil {
+			logError(ctx, "", err, "Unable to save calendar events")
+		}
+	}
+}
+
+func syncGroupCalendar(ctx *RuntimeContext, cfg *AssignmentsConfig, today time.Time, stored calendarEvents) error {
+	days := cfg.Calendar.Days
+	if days <= 0 {
+		days = defaultCalendarWindowDays
+	}
+	endDate := today.AddDate(0, 0, days)
+	schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, today, endDate)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	refs := stored[cfg.GroupName]
+	if refs == nil {
+		refs = make(map[string]calendarEventRef)
+		stored[cfg.GroupName] = refs
+	}
+	// past days are left as they are, only their references are dropped
+	for date := range refs {
+		if date < today.Format(calendarEventsDateLayout) {
+			delete(refs, date)
+		}
+	}
+
+	wanted := make(map[string]*calendar.Event)
+	for _, entry := range schedule {
+		if len(entry.Names) == 0 {
+			continue
+		}
+		wanted[entry.Date.Format(calendarEventsDateLayout)] = calendarEventFor(ctx, cfg, entry)
+	}
+
+	dates := make([]string, 0, len(wanted)+len(refs))
+	for date := range wanted {
+		dates = append(dates, date)
+	}
+	for date := range refs {
+		if _, ok := wanted[date]; !ok {
+			dates = append(dates, date)
+		}
+	}
+	sort.Strings(dates)
+
+	sendUpdates := calendarSendUpdatesNothing
+	if cfg.Calendar.InviteAssignees {
+		sendUpdates = calendarSendUpdatesAll
+	}
+	for _, date := range dates {
+		event, isWanted := wanted[date]
+		ref, isStored := refs[date]
+		if isStored && ref.CalendarID != cfg.Calendar.CalendarID {
+			// calendar changed in config, event is moved by removing it from the old one; reference is kept
+			// when removal fails, so the next run tries again instead of leaving the event behind
+			err := deleteCalendarEvent(ctx, ref, sendUpdates)
+			if err != nil {
+				return err
+			}
+			delete(refs, date)
+			logInfo(ctx, cfg.GroupName, "Deleted event on %s from previous calendar", date)
+			isStored = false
+		}
+		switch {
+		case isWanted && !isStored:
+			created, err := ctx.calendar.Events.Insert(cfg.Calendar.CalendarID, event).SendUpdates(sendUpdates).Do()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			refs[date] = calendarEventRef{CalendarID: cfg.Calendar.CalendarID, EventID: created.Id, Hash: calendarEventHash(event)}
+			logInfo(ctx, cfg.GroupName, "Created event %s on %s", event.Summary, date)
+		case isWanted && ref.Hash != calendarEventHash(event):
+			_, err := ctx.calendar.Events.Update(ref.CalendarID, ref.EventID, event).SendUpdates(sendUpdates).Do()
+			if isGoogleNotFound(err) {
+				// removed by hand, created again
+				var created *calendar.Event
+				created, err = ctx.calendar.Events.Insert(cfg.Calendar.CalendarID, event).SendUpdates(sendUpdates).Do()
+				if err == nil {
+					ref.EventID = created.Id
+				}
+			}
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			ref.Hash = calendarEventHash(event)
+			refs[date] = ref
+			logInfo(ctx, cfg.GroupName, "Updated event %s on %s", event.Summary, date)
+		case !isWanted && isStored:
+			err := deleteCalendarEvent(ctx, ref, sendUpdates)
+			if err != nil {
+				return err
+			}
+			delete(refs, date)
+			logInfo(ctx, cfg.GroupName, "Deleted event on %s", date)
+		}
+	}
+	return nil
+}
+
+func deleteCalendarEvent(ctx *RuntimeContext, ref calendarEventRef, sendUpdates string) error {
+	err := ctx.calendar.Events.Delete(ref.CalendarID, ref.EventID).SendUpdates(sendUpdates).Do()
+	if err != nil && !isGoogleNotFound(err) {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func isGoogleNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusNotFound || apiErr.Code == http.StatusGone
+	}
+	return false
+}
+
+func calendarEventFor(ctx *RuntimeContext, cfg *AssignmentsConfig, entry AssignmentsScheduleEntry) *calendar.Event {
+	date := entry.Date.Format(calendarEventsDateLayout)
+	event := &calendar.Event{
+		Summary:      fmt.Sprintf("%s: %s", cfg.GroupName, icalNames(entry.Names)),
+		Description:  describeNames(entry.Names),
+		Start:        &calendar.EventDateTime{Date: date},
+		End:          &calendar.EventDateTime{Date: entry.Date.AddDate(0, 0, 1).Format(calendarEventsDateLayout)},
+		Transparency: "transparent",
+		ExtendedProperties: &calendar.EventExtendedProperties{
+			Private: map[string]string{calendarGroupProperty: cfg.GroupName, calendarDateProperty: date},
+		},
+	}
+	if cfg.Calendar.InviteAssignees {
+		for _, name := range entry.Names {
+			email := emailOf(ctx, name)
+			if email == "" {
+				logWarn(ctx, cfg.GroupName, "No email address for %s, not invited", name.Name)
+				continue
+			}
+			event.Attendees = append(event.Attendees, &calendar.EventAttendee{Email: email, DisplayName: name.Name})
+		}
+	}
+	return event
+}
+
+// calendarEventHash - changes whenever anything visible in the event changes
+func calendarEventHash(event *calendar.Event) string {
+	attendees := make([]string, len(event.Attendees))
+	for n, attendee := range event.Attendees {
+		attendees[n] = attendee.Email
+	}
+	sum := sha1.Sum([]byte(strings.Join([]string{
+		event.Summary,
+		event.Description,
+		event.Start.Date,
+		strings.Join(attendees, ","),
+	}, "|")))
+	return fmt.Sprintf("%x", sum)
+}
@@ -0,0 +1,182 @@
+package src
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+const (
+	dashboardFile  = "dashboard.html"
+	dashboardWeeks = 4
+)
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>On-call schedule</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #1d1c1d; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ddd; padding: 6px 8px; vertical-align: top; min-width: 110px; }
+th { background: #f4f4f4; }
+.date { font-size: 0.8em; color: #777; }
+.today { outline: 2px solid #1264a3; }
+.weekend { background: #fafafa; }
+.gap { background: #fff4ce; }
+.unmatched { color: #e01e5a; font-weight: bold; }
+.legend span { margin-right: 1.5em; }
+</style>
+</head>
+<body>
+<h1>On-call schedule</h1>
+<p class="date">Generated {{.Generated}}</p>
+<h2>On call now</h2>
+<ul>
+{{- range .Now}}
+<li><b>{{.Group}}</b>: {{if .People}}{{range $n, $p := .People}}{{if $n}}, {{end}}<span{{if $p.Unmatched}} class="unmatched"{{end}}>{{$p.Name}}{{if $p.Role}} ({{$p.Role}}){{end}}</span>{{end}}{{else}}<span class="unmatched">nobody</span>{{end}}</li>
+{{- end}}
+</ul>
+<p class="legend"><span class="gap">nobody assigned</span><span class="unmatched">no Slack match</span></p>
+{{- range .Groups}}
+<h2>{{.Name}}</h2>
+{{- if .Error}}
+<p class="unmatched">{{.Error}}</p>
+{{- else}}
+<table>
+<tr><th>Mon</th><th>Tue</th><th>Wed</th><th>Thu</th><th>Fri</th><th>Sat</th><th>Sun</th></tr>
+{{- range .Weeks}}
+<tr>
+{{- range .}}
+<td class="{{.Class}}"><div class="date">{{.Date}}</div>{{range .People}}<div{{if .Unmatched}} class="unmatched"{{end}}>{{.Name}}{{if .Role}} ({{.Role}}){{end}}</div>{{end}}</td>
+{{- end}}
+</tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+type dashboardPerson struct {
+	Name      string
+	Role      string
+	Unmatched bool
+}
+
+type dashboardDay struct {
+	Date   string
+	Class  string
+	People []dashboardPerson
+}
+
+type dashboardGroup struct {
+	Name  string
+	Error string
+	Weeks [][]dashboardDay
+}
+
+type dashboardNow struct {
+	Group  string
+	People []dashboardPerson
+}
+
+type dashboardData struct {
+	Generated string
+	Now       []dashboardNow
+	Groups    []dashboardGroup
+}
+
+func dashboardPeople(ctx *RuntimeContext, names []NameGroup) []dashboardPerson {
+	people := make([]dashboardPerson, len(names))
+	for n, name := range names {
+		people[n] = dashboardPerson{
+			Name: name.Name,
+			Role: name.Group,
+			// without Slack loaded nothing can be checked
+			Unmatched: len(ctx.users) > 0 && matchUserToNameGroup(ctx, name) == nil,
+		}
+	}
+	return people
+}
+
+func dashboardGroupFor(ctx *RuntimeContext, cfg *AssignmentsConfig, startDate time.Time, today time.Time) dashboardGroup {
+	group := dashboardGroup{Name: cfg.GroupName}
+	if cfg.PagerDutyOnCall != nil {
+		group.Error = "Taken from PagerDuty on-call, no schedule ahead"
+		return group
+	}
+	schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, startDate, startDate.AddDate(0, 0, 7*dashboardWeeks))
+	if err != nil {
+		logError(ctx, cfg.GroupName, err, "Unable to load schedule")
+		group.Error = "Unable to load schedule"
+		return group
+	}
+	for n, entry := range schedule {
+		if n%7 == 0 {
+			group.Weeks = append(group.Weeks, make([]dashboardDay, 0, 7))
+		}
+		classes := make([]string, 0)
+		if !isWorkingDay(cfg, entry.Date) {
+			classes = append(classes, "weekend")
+		} else if len(entry.Names) == 0 && !cfg.KeepWhenMissing {
+			classes = append(classes, "gap")
+		}
+		if dateEqual(entry.Date, today) {
+			classes = append(classes, "today")
+		}
+		week := &group.Weeks[len(group.Weeks)-1]
+		*week = append(*week, dashboardDay{
+			Date:   entry.Date.Format(format),
+			Class:  strings.Join(classes, " "),
+			People: dashboardPeople(ctx, entry.Names),
+		})
+	}
+	return group
+}
+
+func renderDashboard(ctx *RuntimeContext, now time.Time) ([]byte, error) {
+	today := now.In(time.UTC).Truncate(24 * time.Hour)
+	startDate := now.In(time.UTC).Truncate(7 * 24 * time.Hour)
+	data := dashboardData{Generated: now.Format(time.RFC1123)}
+	for _, cfg := range ctx.Configs {
+		if len(ctx.FilterGroups) > 0 && !strings.Contains(ctx.FilterGroups, cfg.GroupName) {
+			continue
+		}
+		day, err := getAssignmentDay(ctx, cfg, today)
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Unable to find current assignment")
+		} else {
+			data.Now = append(data.Now, dashboardNow{Group: cfg.GroupName, People: dashboardPeople(ctx, day.Current)})
+		}
+		data.Groups = append(data.Groups, dashboardGroupFor(ctx, cfg, startDate, today))
+	}
+	var b bytes.Buffer
+	err := dashboardTemplate.Execute(&b, data)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return b.Bytes(), nil
+}
+
+// PublishDashboard - renders self-contained HTML page with upcoming weeks of every group and saves it
+// as "dashboard.html" with given IO strategy (file in CLI, bucket object in Lambda)
+func PublishDashboard(ctx *RuntimeContext, out IOStrategy, now time.Time) {
+	page, err := renderDashboard(ctx, now)
+	if err != nil {
+		logError(ctx, "", err, "Unable to render dashboard")
+		return
+	}
+	err = out.SaveBytes(dashboardFile, page)
+	if err != nil {
+		logError(ctx, "", err, "Unable to save dashboard")
+		return
+	}
+	logInfo(ctx, "", "Saved %s", dashboardFile)
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"os/exec"
@@ -34,7 +33,7 @@ func getSheets(ctx *RuntimeContext) (*sheets.Service, error) {
 	var err error = nil
 	if ctx.GoogleAPIKey != "" {
 		if ctx.GoogleCredentials.ClientID != "" {
-			fmt.Println("Warn: Both Google api key and Google credentials are present, Google api key takes precedence")
+			logWarn(ctx, "", "Both Google api key and Google credentials are present, Google api key takes precedence")
 		}
 		srvc, err = sheets.NewService(context.Background(), option.WithAPIKey(ctx.GoogleAPIKey))
 	}
@@ -42,29 +41,11 @@ func getSheets(ctx *RuntimeContext) (*sheets.Service, error) {
 		if ctx.GoogleCredentials.ClientID == "" || ctx.GoogleCredentials.ProjectID == "" || ctx.GoogleCredentials.ClientSecret == "" {
 			return nil, errors.New("Both Google api key and Google credentials are missing ")
 		}
-
-		googleCredentialsJson := make(map[string]fullGoogleCredentials)
-		googleCredentialsJson["installed"] = fullGoogleCredentials{
-			ClientID:                ctx.GoogleCredentials.ClientID,
-			ProjectID:               ctx.GoogleCredentials.ProjectID,
-			ClientSecret:            ctx.GoogleCredentials.ClientSecret,
-			AuthUri:                 "https://accounts.google.com/o/oauth2/auth",
-			TokenUri:                "https://oauth2.googleapis.com/token",
-			AuthProviderX509CertURL: "https://www.googleapis.com/oauth2/v1/certs",
-			RedirectUris:            []string{"http://localhost:9000/cb"},
-			Origins:                 []string{"http://localhost:9000"},
-		}
-
-		b, err := json.Marshal(googleCredentialsJson)
-		if err != nil {
-			return nil, errors.Wrap(err, 0)
-		}
-
-		config, err := google.ConfigFromJSON(b, "https://www.googleapis.com/auth/spreadsheets.readonly")
+		config, err := googleOAuthConfig(ctx, sheets.SpreadsheetsReadonlyScope)
 		if err != nil {
 			return nil, errors.Wrap(err, 0)
 		}
-		client, err := getClient(ctx, config)
+		client, err := getClient(ctx, config, sheetsTokenName)
 		if err != nil {
 			return nil, errors.Wrap(err, 0)
 		}
@@ -76,12 +57,42 @@ func getSheets(ctx *RuntimeContext) (*sheets.Service, error) {
 	return srvc, nil
 }
 
-func getClient(ctx *RuntimeContext, config *oauth2.Config) (*http.Client, error) {
+// googleOAuthConfig - OAuth2 config of googleCredentials with given scopes
+func googleOAuthConfig(ctx *RuntimeContext, scopes ...string) (*oauth2.Config, error) {
+	googleCredentialsJson := make(map[string]fullGoogleCredentials)
+	googleCredentialsJson["installed"] = fullGoogleCredentials{
+		ClientID:                ctx.GoogleCredentials.ClientID,
+		ProjectID:               ctx.GoogleCredentials.ProjectID,
+		ClientSecret:            ctx.GoogleCredentials.ClientSecret,
+		AuthUri:                 "https://accounts.google.com/o/oauth2/auth",
+		TokenUri:                "https://oauth2.googleapis.com/token",
+		AuthProviderX509CertURL: "https://www.googleapis.com/oauth2/v1/certs",
+		RedirectUris:            []string{"http://localhost:9000/cb"},
+		Origins:                 []string{"http://localhost:9000"},
+	}
+
+	b, err := json.Marshal(googleCredentialsJson)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return google.ConfigFromJSON(b, scopes...)
+}
+
+// tokens are kept per scope, so granting calendar access does not invalidate spreadsheet token
+const (
+	sheetsTokenName   = "token"
+	calendarTokenName = "calendar_token"
+)
+
+func getClient(ctx *RuntimeContext, config *oauth2.Config, tokenName string) (*http.Client, error) {
 	var token *oauth2.Token
-	token, err := tokenFromFile(ctx)
+	token, err := tokenFromFile(ctx, tokenName)
 	if err != nil {
-		token = getTokenFromWeb(ctx, config)
-		err = saveToken(ctx, token)
+		token, err = getTokenFromWeb(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		err = saveToken(ctx, tokenName, token)
 		if err != nil {
 			return nil, err
 		}
@@ -90,7 +101,7 @@ func getClient(ctx *RuntimeContext, config *oauth2.Config) (*http.Client, error)
 	client := oauth2.NewClient(context.Background(), tokenSource)
 	newToken, err := tokenSource.Token()
 	if err == nil {
-		err = saveToken(ctx, newToken)
+		err = saveToken(ctx, tokenName, newToken)
 		if err != nil {
 			return nil, err
 		}
@@ -112,7 +123,7 @@ func adhocAuthCb(w http.ResponseWriter, r *http.Request) {
 	adhocServerClose <- true
 }
 
-func openbrowser(url string) {
+func openbrowser(ctx *RuntimeContext, url string) {
 	var err error
 
 	switch runtime.GOOS {
@@ -126,15 +137,14 @@ func openbrowser(url string) {
 		err = fmt.Errorf("unsupported platform")
 	}
 	if err != nil {
-		log.Fatal(err)
+		logWarn(ctx, "", "Unable to open browser (%s), open %s to grant access", err, url)
 	}
-
 }
 
 // Request a token from the web, then returns the retrieved token.
-func getTokenFromWeb(ctx *RuntimeContext, config *oauth2.Config) *oauth2.Token {
+func getTokenFromWeb(ctx *RuntimeContext, config *oauth2.Config) (*oauth2.Token, error) {
 	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	openbrowser("http://localhost:9000/redirect")
+	openbrowser(ctx, "http://localhost:9000/redirect")
 
 	serverCtx := context.Background()
 	adhocServerClose = make(chan bool)
@@ -159,16 +169,16 @@ func getTokenFromWeb(ctx *RuntimeContext, config *oauth2.Config) *oauth2.Token {
 
 	tok, err := config.Exchange(context.TODO(), adhocServerAuthCode)
 	if err != nil {
-		log.Fatalf("Unable to retrieve token from web: %v", err)
+		return nil, errors.Errorf("Unable to retrieve token from web: %v", err)
 	}
-	return tok
+	return tok, nil
 }
 
 // Retrieves a token from a local file.
-func tokenFromFile(ctx *RuntimeContext) (*oauth2.Token, error) {
+func tokenFromFile(ctx *RuntimeContext, name string) (*oauth2.Token, error) {
 	tok := oauth2.Token{}
 
-	data, err := ctx.io.LoadBytes("token")
+	data, err := ctx.io.LoadBytes(name)
 	if err != nil {
 		return nil, err
 	}
@@ -178,10 +188,10 @@ func tokenFromFile(ctx *RuntimeContext) (*oauth2.Token, error) {
 }
 
 // Saves a token to a file path.
-func saveToken(ctx *RuntimeContext, token *oauth2.Token) error {
+func saveToken(ctx *RuntimeContext, name string, token *oauth2.Token) error {
 	b, err := json.Marshal(token)
 	if err == nil {
-		err = ctx.io.SaveBytes("token", b)
+		err = ctx.io.SaveBytes(name, b)
 	}
 	return err
 }
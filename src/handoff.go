@@ -0,0 +1,266 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// handoffsFile - day of last sent handoff per group, so repeated runs on the same day do not post it again
+	handoffsFile       = "handoffs"
+	handoffsDateLayout = "2006-01-02"
+	// maxGroupDMUsers - conversations.open limit of multi-person DM
+	maxGroupDMUsers = 8
+)
+
+type handoffRole struct {
+	Role     string
+	Outgoing []NameGroup
+	Incoming []NameGroup
+}
+
+// handoffRoleOf returns role of person, escalation tier for PagerDuty on-call groups (their schedules
+// may be replaced between days), group row value otherwise (PagerDuty slot group of spreadsheet configs)
+func handoffRoleOf(name NameGroup) string {
+	if name.Tier > 0 {
+		return fmt.Sprintf("L%d", name.Tier)
+	}
+	return name.Group
+}
+
+// getHandoffs compares previous and current assignment per role, roles without changes are omitted
+func getHandoffs(day *assignmentDay) []handoffRole {
+	roles := make([]string, 0)
+	for _, names := range [][]NameGroup{day.Previous, day.Current} {
+		for _, name := range names {
+			if !contains(roles, handoffRoleOf(name)) {
+				roles = append(roles, handoffRoleOf(name))
+			}
+		}
+	}
+	handoffs := make([]handoffRole, 0, len(roles))
+	for _, role := range roles {
+		previous := filterRole(day.Previous, role)
+		current := filterRole(day.Current, role)
+		handoff := handoffRole{Role: role}
+		for _, name := range previous {
+			if !containsName(current, name.Name) {
+				handoff.Outgoing = append(handoff.Outgoing, name)
+			}
+		}
+		for _, name := range current {
+			if !containsName(previous, name.Name) {
+				handoff.Incoming = append(handoff.Incoming, name)
+			}
+		}
+		if len(handoff.Outgoing) > 0 || len(handoff.Incoming) > 0 {
+			handoffs = append(handoffs, handoff)
+		}
+	}
+	return handoffs
+}
+
+func filterRole(names []NameGroup, role string) []NameGroup {
+	filtered := make([]NameGroup, 0, len(names))
+	for _, name := range names {
+		if handoffRoleOf(name) == role {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
+func handoffTemplateData(ctx *RuntimeContext, cfg *AssignmentsConfig, day *assignmentDay, handoffs []handoffRole) (*TemplateData, error) {
+	data := templateDataForDay(ctx, cfg, day)
+	data.Handoffs = make([]TemplateHandoff, len(handoffs))
+	for n, handoff := range handoffs {
+		data.Handoffs[n] = TemplateHandoff{
+			Role:     handoff.Role,
+			Outgoing: toTemplatePeople(ctx, handoff.Outgoing),
+			Incoming: toTemplatePeople(ctx, handoff.Incoming),
+		}
+	}
+	// checklist items are templates themselves, so they can refer to people
+	data.Checklist = make([]string, len(cfg.Handoff.Checklist))
+	for n, item := range cfg.Handoff.Checklist {
+		rendered, err := renderTemplate("checklist", item, data)
+		if err != nil {
+			return nil, err
+		}
+		data.Checklist[n] = rendered
+	}
+	return data, nil
+}
+
+func handoffBlocks(cfg *AssignmentsConfig, data *TemplateData) ([]slack.Block, error) {
+	if cfg.Templates != nil {
+		blocks, err := renderMessageBlocks("handoff", cfg.Templates.Handoff, cfg.Templates.HandoffBlocks, data)
+		if err != nil || blocks != nil {
+			return blocks, err
+		}
+	}
+
+	mentions := func(people []TemplatePerson) string {
+		if len(people) == 0 {
+			return "_nobody_"
+		}
+		return joinMentions(people)
+	}
+
+	blocks := []slack.Block{sectionBlockFor(fmt.Sprintf("*%s* handoff for %s", data.Group, data.Date.Format(format)))}
+	for _, handoff := range data.Handoffs {
+		role := handoff.Role
+		if role == "" {
+			role = data.Group
+		}
+		blocks = append(blocks, contextBlockFor(
+			role,
+			fmt.Sprintf("%s :arrow_right: %s", mentions(handoff.Outgoing), mentions(handoff.Incoming)),
+		))
+	}
+	if len(data.Checklist) > 0 {
+		var b strings.Builder
+		fmt.Fprintln(&b, "Please go through handoff checklist:")
+		for _, item := range data.Checklist {
+			fmt.Fprintf(&b, "• %s\n", item)
+		}
+		blocks = append(blocks, sectionBlockFor(b.String()))
+	}
+	return blocks, nil
+}
+
+func loadSentHandoffs(ctx *RuntimeContext) map[string]string {
+	sent := make(map[string]string)
+	data, err := loadState(ctx, handoffsFile)
+	if err != nil {
+		return sent
+	}
+	if err = json.Unmarshal(data, &sent); err != nil {
+		logWarn(ctx, "", "Unable to parse sent handoffs, starting from scratch")
+		return make(map[string]string)
+	}
+	return sent
+}
+
+func saveSentHandoff(ctx *RuntimeContext, cfg *AssignmentsConfig, date time.Time) error {
+	sent := loadSentHandoffs(ctx)
+	sent[cfg.GroupName] = date.Format(handoffsDateLayout)
+	data, err := json.Marshal(sent)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return saveState(ctx, handoffsFile, data)
+}
+
+// handoffDMUsers returns Slack IDs of outgoing and incoming people
+func handoffDMUsers(data *TemplateData) []string {
+	userIds := make([]string, 0)
+	for _, handoff := range data.Handoffs {
+		for _, people := range [][]TemplatePerson{handoff.Outgoing, handoff.Incoming} {
+			for _, person := range people {
+				if person.SlackID != "" && !contains(userIds, person.SlackID) {
+					userIds = append(userIds, person.SlackID)
+				}
+			}
+		}
+	}
+	return userIds
+}
+
+func sendHandoff(ctx *RuntimeContext, cfg *AssignmentsConfig, day *assignmentDay) error {
+	if cfg.Handoff == nil {
+		return nil
+	}
+	if loadSentHandoffs(ctx)[cfg.GroupName] == day.Date.Format(handoffsDateLayout) {
+		logInfo(ctx, cfg.GroupName, "Handoff already sent")
+		return nil
+	}
+	handoffs := getHandoffs(day)
+	if len(handoffs) == 0 {
+		logInfo(ctx, cfg.GroupName, "No handoff")
+		return nil
+	}
+	data, err := handoffTemplateData(ctx, cfg, day, handoffs)
+	if err != nil {
+		return err
+	}
+	blocks, err := handoffBlocks(cfg, data)
+	if err != nil {
+		return err
+	}
+
+	var channelID string
+	if cfg.Handoff.DirectMessage {
+		userIds := handoffDMUsers(data)
+		if len(userIds) == 0 {
+			logWarn(ctx, cfg.GroupName, "No Slack users to send handoff to")
+			return nil
+		}
+		if len(userIds) > maxGroupDMUsers {
+			return errors.Errorf("Handoff has %d people, group DM allows at most %d, use channel instead", len(userIds), maxGroupDMUsers)
+		}
+		channel, _, _, err := ctx.slack.OpenConversation(&slack.OpenConversationParameters{
+			Users: userIds,
+		})
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+		channelID = channel.ID
+	} else {
+		channelName := cfg.Handoff.Channel
+		if channelName == "" {
+			channelName = cfg.NotifyChannel
+		}
+		channel := matchChannelToName(ctx, channelName)
+		if channel == nil {
+			return errors.Errorf("Unable to match handoff channel '%s'", channelName)
+		}
+		channelID = channel.ID
+		ctx.slack.JoinConversation(channelID)
+	}
+
+	logInfo(ctx, cfg.GroupName, "Sending handoff")
+	_, _, err = ctx.slack.PostMessage(
+		channelID,
+		slack.MsgOptionBlocks(blocks...),
+	)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	err = saveSentHandoff(ctx, cfg, day.Date)
+	if err == errNoStateStorage {
+		logWarn(ctx, cfg.GroupName, "No state storage, handoff may be sent again today")
+		return nil
+	}
+	return err
+}
+
+// NotifyHandoff - sends handoff messages without assigning Slack groups (eg. for PagerDuty only configs)
+func NotifyHandoff(ctx *RuntimeContext, date time.Time) {
+	for _, cfg := range ctx.Configs {
+		if len(ctx.FilterGroups) > 0 && !strings.Contains(ctx.FilterGroups, cfg.GroupName) {
+			continue
+		}
+		if cfg.Handoff == nil {
+			continue
+		}
+		done := startRun(ctx, "notifyHandoff", cfg.GroupName)
+		day, err := getAssignmentDay(ctx, cfg, date)
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Error while loading assigned people from spreadsheet")
+			done(err)
+			continue
+		}
+		err = sendHandoff(ctx, cfg, day)
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Error while sending handoff")
+			countBackendError(ctx, backendSlack)
+		}
+		done(err)
+	}
+}
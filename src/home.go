@@ -0,0 +1,169 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/slack-go/slack"
+)
+
+// homeDays - how many days ahead are presented in App Home
+const homeDays = 28
+
+const refreshHomeActionID = "refresh_home"
+
+type groupSchedule struct {
+	cfg      *AssignmentsConfig
+	schedule []AssignmentsScheduleEntry
+}
+
+func getGroupSchedules(ctx *RuntimeContext, startDate, endDate time.Time) []groupSchedule {
+	schedules := make([]groupSchedule, 0, len(ctx.Configs))
+	for _, cfg := range ctx.Configs {
+		schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, startDate, endDate)
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Unable to find assignments")
+			continue
+		}
+		schedules = append(schedules, groupSchedule{cfg: cfg, schedule: schedule})
+	}
+	return schedules
+}
+
+func slackMentionsFor(ctx *RuntimeContext, names []NameGroup, skipUserID string) []string {
+	mentions := make([]string, 0, len(names))
+	for _, name := range names {
+		person := toTemplatePerson(ctx, name)
+		if skipUserID != "" && person.SlackID == skipUserID {
+			continue
+		}
+		mentions = append(mentions, person.Mention)
+	}
+	return mentions
+}
+
+func homeViewForUser(ctx *RuntimeContext, userID string, schedules []groupSchedule, now time.Time) slack.HomeTabViewRequest {
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, "Your schedule", false, false)),
+	}
+
+	upcoming := 0
+	for _, gs := range schedules {
+		for _, entry := range gs.schedule {
+			var own *NameGroup
+			for n, name := range entry.Names {
+				if user := matchUserToNameGroup(ctx, name); user != nil && user.ID == userID {
+					own = &entry.Names[n]
+					break
+				}
+			}
+			if own == nil {
+				continue
+			}
+			upcoming++
+			text := fmt.Sprintf("*%s*", gs.cfg.GroupName)
+			if own.Group != "" {
+				text += fmt.Sprintf(" (%s)", own.Group)
+			}
+			if others := slackMentionsFor(ctx, entry.Names, userID); len(others) > 0 {
+				text += " with " + strings.Join(others, ", ")
+			}
+			blocks = append(blocks, contextBlockFor(entry.Date.Format(format), text))
+		}
+	}
+	if upcoming == 0 {
+		blocks = append(blocks, sectionBlockFor(fmt.Sprintf("You have no assignments in the next %d days.", homeDays)))
+	}
+
+	blocks = append(
+		blocks,
+		slack.NewDividerBlock(),
+		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, "Today", false, false)),
+	)
+	blocks = append(blocks, todayBlocks(ctx, schedules, now)...)
+	blocks = append(blocks, slack.NewActionBlock(
+		"",
+		slack.NewButtonBlockElement(
+			refreshHomeActionID,
+			"",
+			slack.NewTextBlockObject(slack.PlainTextType, "Refresh", false, false),
+		),
+	))
+
+	return slack.HomeTabViewRequest{
+		Type:   slack.VTHomeTab,
+		Blocks: slack.Blocks{BlockSet: blocks},
+	}
+}
+
+func todayBlocks(ctx *RuntimeContext, schedules []groupSchedule, now time.Time) []slack.Block {
+	blocks := make([]slack.Block, 0, len(schedules))
+	for _, gs := range schedules {
+		var today *AssignmentsScheduleEntry
+		for n := range gs.schedule {
+			if dateEqual(gs.schedule[n].Date, now) {
+				today = &gs.schedule[n]
+				break
+			}
+		}
+		assignmentsStr := "*nobody is assigned*"
+		if today != nil && len(today.Names) > 0 {
+			assignmentsStr = strings.Join(slackMentionsFor(ctx, today.Names, ""), ", ")
+		} else if gs.cfg.KeepWhenMissing {
+			assignmentsStr = "*same as previous day*"
+		}
+		blocks = append(blocks, contextBlockFor(fmt.Sprintf("*%s*", gs.cfg.GroupName), assignmentsStr))
+	}
+	return blocks
+}
+
+func homeScheduleRange(now time.Time) (time.Time, time.Time) {
+	startDate := now.In(time.UTC).Truncate(24 * time.Hour)
+	return startDate, startDate.AddDate(0, 0, homeDays)
+}
+
+// publishHomeViews publishes view of every user, failure of one user does not stop the others
+func publishHomeViews(ctx *RuntimeContext, userIDs []string, schedules []groupSchedule, now time.Time) error {
+	failures := make([]string, 0)
+	for _, userID := range userIDs {
+		_, err := ctx.slack.PublishView(userID, homeViewForUser(ctx, userID, schedules, now), "")
+		if err != nil {
+			countBackendError(ctx, backendSlack)
+			logError(ctx, "", errors.Wrap(err, 0), "Unable to publish App Home of %s", userID)
+			failures = append(failures, userID)
+		}
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("App Home publishing failed for: %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// publishHomeForUser - failure is logged by publishHomeViews
+func publishHomeForUser(ctx *RuntimeContext, userID string, now time.Time) {
+	startDate, endDate := homeScheduleRange(now)
+	publishHomeViews(ctx, []string{userID}, getGroupSchedules(ctx, startDate, endDate), now)
+}
+
+// PublishHome - refreshes App Home of everybody present in upcoming schedules
+func PublishHome(ctx *RuntimeContext, now time.Time) {
+	startDate, endDate := homeScheduleRange(now)
+	schedules := getGroupSchedules(ctx, startDate, endDate)
+	userIDs := make([]string, 0)
+	for _, gs := range schedules {
+		for _, entry := range gs.schedule {
+			for _, name := range entry.Names {
+				if user := matchUserToNameGroup(ctx, name); user != nil && !contains(userIDs, user.ID) {
+					userIDs = append(userIDs, user.ID)
+				}
+			}
+		}
+	}
+	logInfo(ctx, "", "Publishing App Home for %d user(s)", len(userIDs))
+	err := publishHomeViews(ctx, userIDs, schedules, now)
+	if err != nil {
+		logError(ctx, "", err, "Unable to publish App Home")
+	}
+}
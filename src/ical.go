@@ -0,0 +1,317 @@
+package src
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+// calendar window, feeds are regenerated on every request so it rolls with time
+const (
+	icalPastDays   = 14
+	icalFutureDays = 56
+	icalUIDDomain  = "spbot"
+)
+
+// icalEvent - all day event of single assignment day
+type icalEvent struct {
+	uid         string
+	date        time.Time
+	summary     string
+	description string
+}
+
+// icalUID is derived from the feed, group and date only (person for personal feeds),
+// so changed assignment replaces event of the day instead of adding another one
+func icalUID(parts ...string) string {
+	return fmt.Sprintf("%x@%s", sha1.Sum([]byte(strings.Join(parts, "|"))), icalUIDDomain)
+}
+
+func icalWindow(now time.Time) (time.Time, time.Time) {
+	today := now.In(time.UTC).Truncate(24 * time.Hour)
+	return today.AddDate(0, 0, -icalPastDays), today.AddDate(0, 0, icalFutureDays)
+}
+
+func icalNames(names []NameGroup) string {
+	parts := make([]string, len(names))
+	for n, name := range names {
+		parts[n] = name.Name
+	}
+	return strings.Join(parts, ", ")
+}
+
+// calendarGroups returns groups with spreadsheet schedule (on-call groups have no future to show)
+func calendarGroups(ctx *RuntimeContext) []*AssignmentsConfig {
+	configs := make([]*AssignmentsConfig, 0, len(ctx.Configs))
+	for _, cfg := range ctx.Configs {
+		if cfg.PagerDutyOnCall == nil {
+			configs = append(configs, cfg)
+		}
+	}
+	return configs
+}
+
+// calendarSchedule - schedule of single group within the window
+type calendarSchedule struct {
+	cfg      *AssignmentsConfig
+	schedule []AssignmentsScheduleEntry
+}
+
+func loadCalendarSchedules(ctx *RuntimeContext, configs []*AssignmentsConfig, startDate, endDate time.Time) ([]calendarSchedule, error) {
+	schedules := make([]calendarSchedule, 0, len(configs))
+	for _, cfg := range configs {
+		schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, startDate, endDate)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		schedules = append(schedules, calendarSchedule{cfg: cfg, schedule: schedule})
+	}
+	return schedules, nil
+}
+
+func groupICalEvents(group calendarSchedule) []icalEvent {
+	events := make([]icalEvent, 0, len(group.schedule))
+	for _, entry := range group.schedule {
+		if len(entry.Names) == 0 {
+			continue
+		}
+		events = append(events, icalEvent{
+			uid:         icalUID("group", group.cfg.GroupName, entry.Date.Format("2006-01-02")),
+			date:        entry.Date,
+			summary:     fmt.Sprintf("%s: %s", group.cfg.GroupName, icalNames(entry.Names)),
+			description: describeNames(entry.Names),
+		})
+	}
+	return events
+}
+
+func personICalEvents(schedules []calendarSchedule, person string) []icalEvent {
+	person = cleanUpName(person)
+	events := make([]icalEvent, 0)
+	for _, group := range schedules {
+		for _, entry := range group.schedule {
+			for _, name := range entry.Names {
+				if !strings.EqualFold(name.Name, person) {
+					continue
+				}
+				summary := group.cfg.GroupName
+				if name.Group != "" {
+					summary = fmt.Sprintf("%s (%s)", group.cfg.GroupName, name.Group)
+				}
+				events = append(events, icalEvent{
+					uid:         icalUID("person", strings.ToLower(person), group.cfg.GroupName, entry.Date.Format("2006-01-02")),
+					date:        entry.Date,
+					summary:     summary,
+					description: describeNames(entry.Names),
+				})
+				break
+			}
+		}
+	}
+	return events
+}
+
+func describeNames(names []NameGroup) string {
+	lines := make([]string, len(names))
+	for n, name := range names {
+		if name.Group != "" {
+			lines[n] = fmt.Sprintf("%s (%s)", name.Name, name.Group)
+		} else {
+			lines[n] = name.Name
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeICalendar renders RFC 5545 calendar with all day events
+func writeICalendar(name string, events []icalEvent, now time.Time) []byte {
+	var b bytes.Buffer
+	line := func(text string) {
+		b.WriteString(foldICalLine(text))
+		b.WriteString("\r\n")
+	}
+	stamp := now.In(time.UTC).Format("20060102T150405Z")
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//spbot//schedule//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escapeICalText(name))
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + event.uid)
+		line("DTSTAMP:" + stamp)
+		line("DTSTART;VALUE=DATE:" + event.date.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + event.date.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:" + escapeICalText(event.summary))
+		if event.description != "" {
+			line("DESCRIPTION:" + escapeICalText(event.description))
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.Bytes()
+}
+
+func escapeICalText(text string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(text)
+}
+
+// foldICalLine splits lines longer than 75 octets without breaking UTF-8 sequences
+func foldICalLine(text string) string {
+	if len(text) <= 75 {
+		return text
+	}
+	var b strings.Builder
+	lineLen := 0
+	for _, r := range text {
+		size := len(string(r))
+		if lineLen+size > 75 {
+			b.WriteString("\r\n ")
+			lineLen = 1
+		}
+		b.WriteRune(r)
+		lineLen += size
+	}
+	return b.String()
+}
+
+// feedFileName keeps only characters safe for file names and S3 keys, spaces become underscores,
+// names with anything else replaced get hash of the original name so eg. "Łukasz" and "Żukasz" do not
+// overwrite each other
+func feedFileName(prefix, name string) string {
+	name = strings.ReplaceAll(name, " ", "_")
+	safe := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+	if safe != name {
+		safe = fmt.Sprintf("%s_%x", safe, sha1.Sum([]byte(name)))[:len(safe)+9]
+	}
+	return fmt.Sprintf("%s_%s.ics", prefix, safe)
+}
+
+// ExportICalendar - saves calendar feed of every group and of every person in the window
+// to out (current directory in CLI, S3 bucket in Lambda)
+func ExportICalendar(ctx *RuntimeContext, out IOStrategy, now time.Time) {
+	startDate, endDate := icalWindow(now)
+	configs := make([]*AssignmentsConfig, 0)
+	for _, cfg := range calendarGroups(ctx) {
+		if len(ctx.FilterGroups) > 0 && !strings.Contains(ctx.FilterGroups, cfg.GroupName) {
+			continue
+		}
+		configs = append(configs, cfg)
+	}
+	schedules, err := loadCalendarSchedules(ctx, configs, startDate, endDate)
+	if err != nil {
+		logError(ctx, "", err, "Unable to load schedules")
+		return
+	}
+
+	feeds := make(map[string][]byte)
+	people := make(map[string]bool)
+	for _, group := range schedules {
+		events := groupICalEvents(group)
+		feeds[feedFileName("calendar", group.cfg.GroupName)] = writeICalendar(group.cfg.GroupName, events, now)
+		for _, entry := range group.schedule {
+			for _, name := range entry.Names {
+				people[name.Name] = true
+			}
+		}
+	}
+	for person := range people {
+		events := personICalEvents(schedules, person)
+		feeds[feedFileName("calendar_person", person)] = writeICalendar(person, events, now)
+	}
+
+	for name, feed := range feeds {
+		err = out.SaveBytes(name, feed)
+		if err != nil {
+			logError(ctx, "", err, "Unable to save calendar %s", name)
+			continue
+		}
+		logInfo(ctx, "", "Saved %s", name)
+	}
+}
+
+// HandleICalRequest - serves /ical/groups/<group>.ics and /ical/people/<name>.ics feeds,
+// token is passed in query as calendar apps are unable to send headers, feeds are not served without icalToken
+// as they expose names of everybody in every group
+func HandleICalRequest(ctx *RuntimeContext, path string, query url.Values) *HTTPResponse {
+	if ctx.ICalToken == "" {
+		logWarn(ctx, "", "Calendar feed %s requested but icalToken is not configured", path)
+		return &HTTPResponse{Status: http.StatusNotFound}
+	}
+	if subtle.ConstantTimeCompare([]byte(query.Get("token")), []byte(ctx.ICalToken)) != 1 {
+		return &HTTPResponse{Status: http.StatusUnauthorized}
+	}
+	path = strings.TrimPrefix(path, "/ical/")
+	if !strings.HasSuffix(path, ".ics") {
+		return &HTTPResponse{Status: http.StatusNotFound}
+	}
+	parts := strings.SplitN(strings.TrimSuffix(path, ".ics"), "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return &HTTPResponse{Status: http.StatusNotFound}
+	}
+
+	configs := calendarGroups(ctx)
+	if parts[0] == "groups" {
+		configs = make([]*AssignmentsConfig, 0, 1)
+		for _, cfg := range calendarGroups(ctx) {
+			if strings.EqualFold(cfg.GroupName, parts[1]) {
+				configs = append(configs, cfg)
+			}
+		}
+		if len(configs) == 0 {
+			return &HTTPResponse{Status: http.StatusNotFound}
+		}
+	} else if parts[0] != "people" {
+		return &HTTPResponse{Status: http.StatusNotFound}
+	}
+
+	now := time.Now()
+	startDate, endDate := icalWindow(now)
+	schedules, err := loadCalendarSchedules(ctx, configs, startDate, endDate)
+	if err != nil {
+		logError(ctx, "", err, "Unable to build calendar %s", path)
+		return &HTTPResponse{Status: http.StatusInternalServerError}
+	}
+	var events []icalEvent
+	if parts[0] == "groups" {
+		events = groupICalEvents(schedules[0])
+	} else {
+		events = personICalEvents(schedules, parts[1])
+	}
+	return &HTTPResponse{Status: http.StatusOK, Body: writeICalendar(parts[1], events, now)}
+}
+
+func icalHandler(ctx *RuntimeContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		response := HandleICalRequest(ctx, r.URL.Path, r.URL.Query())
+		if response.Status == http.StatusOK {
+			w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		}
+		w.WriteHeader(response.Status)
+		w.Write(response.Body)
+	}
+}
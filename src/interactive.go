@@ -0,0 +1,90 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// Handlers below are shared by HTTP, Lambda and Socket Mode entry points, each
+// returns task to be performed after request is acknowledged (or nil)
+
+func handleSlackEvent(ctx *RuntimeContext, event slackevents.EventsAPIEvent) func() {
+	if event.Type != slackevents.CallbackEvent {
+		return nil
+	}
+	switch innerEvent := event.InnerEvent.Data.(type) {
+	case *slackevents.AppHomeOpenedEvent:
+		if innerEvent.Tab != "home" {
+			return nil
+		}
+		return func() {
+			publishHomeForUser(ctx, innerEvent.User, time.Now())
+		}
+	}
+	return nil
+}
+
+func handleSlashCommand(ctx *RuntimeContext, command slack.SlashCommand) func() {
+	return func() {
+		blocks, err := slashCommandBlocks(ctx, strings.TrimSpace(command.Text), time.Now())
+		if err != nil {
+			logError(ctx, "", err, "Unable to handle command %s %s", command.Command, command.Text)
+			blocks = []slack.Block{sectionBlockFor(fmt.Sprintf("Sorry, something went wrong: %s", err))}
+		}
+		err = slack.PostWebhook(command.ResponseURL, &slack.WebhookMessage{
+			ResponseType: slack.ResponseTypeEphemeral,
+			Blocks:       &slack.Blocks{BlockSet: blocks},
+		})
+		if err != nil {
+			logError(ctx, "", err, "Unable to respond to command %s", command.Command)
+		}
+	}
+}
+
+// slashCommandBlocks - without arguments shows today's coverage, with group
+// name shows this week's schedule ("next" suffix shows next week)
+func slashCommandBlocks(ctx *RuntimeContext, text string, now time.Time) ([]slack.Block, error) {
+	if text == "" {
+		startDate := now.In(time.UTC).Truncate(24 * time.Hour)
+		schedules := getGroupSchedules(ctx, startDate, startDate.AddDate(0, 0, 1))
+		return todayBlocks(ctx, schedules, now), nil
+	}
+	if text == "help" {
+		return []slack.Block{sectionBlockFor(
+			"`<command>` - who is on call today\n`<command> group` - schedule for this week\n`<command> group next` - schedule for next week",
+		)}, nil
+	}
+
+	args := strings.Fields(text)
+	startDate := now.In(time.UTC).Truncate(7 * 24 * time.Hour)
+	title := "schedule for this week"
+	if len(args) > 1 && args[1] == "next" {
+		startDate = startDate.AddDate(0, 0, 7)
+		title = "schedule for next week"
+	}
+	for _, cfg := range ctx.Configs {
+		if cfg.GroupName == args[0] {
+			return getScheduleForDateAsSlackBlocks(ctx, cfg, startDate, startDate.AddDate(0, 0, 7), title)
+		}
+	}
+	return nil, errors.Errorf("Unknown group '%s'", args[0])
+}
+
+func handleInteraction(ctx *RuntimeContext, callback slack.InteractionCallback) func() {
+	if callback.Type != slack.InteractionTypeBlockActions {
+		return nil
+	}
+	for _, action := range callback.ActionCallback.BlockActions {
+		if action.ActionID == refreshHomeActionID {
+			return func() {
+				publishHomeForUser(ctx, callback.User.ID, time.Now())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package src
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = map[logLevel]string{
+	levelDebug: "debug",
+	levelInfo:  "info",
+	levelWarn:  "warn",
+	levelError: "error",
+}
+
+var logLevelColors = map[logLevel]string{
+	levelDebug: "\033[0;90m",
+	levelInfo:  "\033[0;36m",
+	levelWarn:  "\033[0;33m",
+	levelError: "\033[0;31m",
+}
+
+const colorReset = "\033[0m"
+
+// runLogger - structured log lines of single run written to stderr: JSON when stderr is not a terminal (Lambda,
+// CloudWatch, redirects), coloured text otherwise; LOG_FORMAT=json|text overrides the choice
+type runLogger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	json  bool
+	color bool
+	runID string
+}
+
+func newRunLogger() *runLogger {
+	terminal := isTerminal(os.Stderr)
+	logger := &runLogger{out: os.Stderr, json: !terminal, color: terminal, runID: newRunID()}
+	switch os.Getenv("LOG_FORMAT") {
+	case "json":
+		logger.json = true
+	case "text":
+		logger.json = false
+	}
+	return logger
+}
+
+func newRunID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xFFFFFFFF)
+	}
+	return hex.EncodeToString(b)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (l *runLogger) write(ctx *RuntimeContext, level logLevel, group, message string, err error) {
+	// Verbose enables debug lines (stack traces included)
+	if level == levelDebug && !ctx.Verbose {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.json {
+		line := map[string]interface{}{
+			"time":  now.UTC().Format(time.RFC3339Nano),
+			"level": logLevelNames[level],
+			"run":   l.runID,
+			"msg":   message,
+		}
+		if ctx.Command != "" {
+			line["command"] = ctx.Command
+		}
+		if group != "" {
+			line["group"] = group
+		}
+		if err != nil {
+			line["error"] = err.Error()
+		}
+		data, _ := json.Marshal(line)
+		fmt.Fprintln(l.out, string(data))
+		return
+	}
+	var b strings.Builder
+	levelName := fmt.Sprintf("%-5s", strings.ToUpper(logLevelNames[level]))
+	if l.color {
+		levelName = logLevelColors[level] + levelName + colorReset
+	}
+	fmt.Fprintf(&b, "%s %s [run=%s", now.Format("15:04:05"), levelName, l.runID)
+	if ctx.Command != "" {
+		fmt.Fprintf(&b, " cmd=%s", ctx.Command)
+	}
+	if group != "" {
+		fmt.Fprintf(&b, " group=%s", group)
+	}
+	fmt.Fprintf(&b, "] %s", message)
+	if err != nil {
+		fmt.Fprintf(&b, ": %s", err)
+	}
+	fmt.Fprintln(l.out, b.String())
+}
+
+func logAt(ctx *RuntimeContext, level logLevel, group string, err error, format string, args ...interface{}) {
+	if ctx.logger == nil {
+		ctx.logger = newRunLogger()
+	}
+	ctx.logger.write(ctx, level, group, fmt.Sprintf(format, args...), err)
+}
+
+func logDebug(ctx *RuntimeContext, group, format string, args ...interface{}) {
+	logAt(ctx, levelDebug, group, nil, format, args...)
+}
+
+func logInfo(ctx *RuntimeContext, group, format string, args ...interface{}) {
+	logAt(ctx, levelInfo, group, nil, format, args...)
+}
+
+func logWarn(ctx *RuntimeContext, group, format string, args ...interface{}) {
+	logAt(ctx, levelWarn, group, nil, format, args...)
+}
+
+// logError logs error with message, stack trace is logged on debug level
+func logError(ctx *RuntimeContext, group string, err error, format string, args ...interface{}) {
+	logAt(ctx, levelError, group, err, format, args...)
+	if err != nil {
+		logDebug(ctx, group, "%s", Stack(err))
+	}
+}
+
+// Fatal - logs error ending the run, saves metrics recorded so far (when exposed) and exits, meant for main only,
+// everything in the package returns errors instead
+func Fatal(ctx *RuntimeContext, err error) {
+	if ctx == nil {
+		ctx = &RuntimeContext{}
+	}
+	logError(ctx, "", err, "Fatal error")
+	SaveMetrics(ctx)
+	os.Exit(1)
+}
+
+// LogInfo - info line for commands outside of the package (main, Lambda)
+func LogInfo(ctx *RuntimeContext, format string, args ...interface{}) {
+	logInfo(ctx, "", format, args...)
+}
@@ -0,0 +1,349 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+// metrics of CLI runs are merged into "metrics" file, so server or daemon can expose them as well
+// as its own ones; the file is created by the process exposing /metrics and runs save nothing without it
+const metricsFile = "metrics"
+
+// metricsLockFile - locked while metrics file is merged and replaced, so concurrent runs do not lose counters
+const metricsLockFile = metricsFile + ".lock"
+
+// errMetricsNotExposed - no process exposes stored metrics, there is nobody to save them for
+var errMetricsNotExposed = errors.New("metrics are not exposed")
+
+const (
+	metricRuns             = "spbot_runs_total"
+	metricRunDuration      = "spbot_run_duration_seconds"
+	metricBackendErrors    = "spbot_backend_errors_total"
+	metricSpreadsheetFetch = "spbot_spreadsheet_fetch_duration_seconds"
+	metricUnmatchedNames   = "spbot_unmatched_names"
+	metricLastAssignment   = "spbot_last_successful_assignment_timestamp_seconds"
+	metricSummarySum       = "_sum"
+	metricSummaryCount     = "_count"
+	metricTypeCounter      = "counter"
+	metricTypeGauge        = "gauge"
+	metricTypeSummary      = "summary"
+	backendSheets          = "sheets"
+	backendSlack           = "slack"
+	backendPagerDuty       = "pagerduty"
+	backendOpsgenie        = "opsgenie"
+	backendGoogleCalendar  = "googleCalendar"
+	runStatusOK            = "ok"
+	runStatusError         = "error"
+	metricsContentType     = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var metricFamilies = map[string]struct{ kind, help string }{
+	metricRuns:             {metricTypeCounter, "Runs of commands per group and status."},
+	metricRunDuration:      {metricTypeSummary, "Duration of command runs per group."},
+	metricBackendErrors:    {metricTypeCounter, "Errors returned by backends (sheets, slack, pagerduty, ...)."},
+	metricSpreadsheetFetch: {metricTypeSummary, "Latency of spreadsheet fetches per group."},
+	metricUnmatchedNames:   {metricTypeGauge, "Names of current assignment without Slack match per group."},
+	metricLastAssignment:   {metricTypeGauge, "Unix time of last successful assignGroups run per group."},
+}
+
+// metricSample - single series, key is its exposition form: name{label="value",...}
+type metricSample struct {
+	Family string  `json:"family"`
+	Gauge  bool    `json:"gauge"`
+	Value  float64 `json:"value"`
+}
+
+// metricsRegistry - samples recorded by this process
+type metricsRegistry struct {
+	mu      sync.Mutex
+	samples map[string]*metricSample
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{samples: make(map[string]*metricSample)}
+}
+
+func metricKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for n, key := range keys {
+		pairs[n] = fmt.Sprintf("%s=%s", key, strconv.Quote(labels[key]))
+	}
+	return fmt.Sprintf("%s{%s}", name, strings.Join(pairs, ","))
+}
+
+func (r *metricsRegistry) record(family, name string, labels map[string]string, value float64, gauge bool) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := metricKey(name, labels)
+	sample, ok := r.samples[key]
+	if !ok {
+		sample = &metricSample{Family: family, Gauge: gauge}
+		r.samples[key] = sample
+	}
+	if gauge {
+		sample.Value = value
+	} else {
+		sample.Value += value
+	}
+}
+
+func (r *metricsRegistry) add(name string, labels map[string]string, value float64) {
+	r.record(name, name, labels, value, false)
+}
+
+func (r *metricsRegistry) set(name string, labels map[string]string, value float64) {
+	r.record(name, name, labels, value, true)
+}
+
+func (r *metricsRegistry) observe(name string, labels map[string]string, duration time.Duration) {
+	r.record(name, name+metricSummarySum, labels, duration.Seconds(), false)
+	r.record(name, name+metricSummaryCount, labels, 1, false)
+}
+
+// mergeInto adds counters and overwrites gauges of target
+func (r *metricsRegistry) mergeInto(target map[string]*metricSample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, sample := range r.samples {
+		existing, ok := target[key]
+		if !ok || sample.Gauge {
+			copied := *sample
+			target[key] = &copied
+			continue
+		}
+		existing.Value += sample.Value
+	}
+}
+
+// take returns recorded samples and starts from scratch, so samples recorded meanwhile
+// by other goroutines are neither lost nor saved twice
+func (r *metricsRegistry) take() map[string]*metricSample {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	samples := r.samples
+	r.samples = make(map[string]*metricSample)
+	return samples
+}
+
+// putBack returns taken samples which could not be saved, gauges recorded meanwhile are newer
+func (r *metricsRegistry) putBack(samples map[string]*metricSample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, sample := range samples {
+		existing, ok := r.samples[key]
+		if !ok {
+			r.samples[key] = sample
+		} else if !sample.Gauge {
+			existing.Value += sample.Value
+		}
+	}
+}
+
+// startRun returns function finishing the run of command for group (empty when not per group)
+func startRun(ctx *RuntimeContext, command, group string) func(err error) {
+	started := time.Now()
+	return func(err error) {
+		labels := map[string]string{"command": command, "group": group}
+		ctx.metrics.observe(metricRunDuration, labels, time.Since(started))
+		status := runStatusOK
+		if err != nil {
+			status = runStatusError
+		}
+		ctx.metrics.add(metricRuns, map[string]string{"command": command, "group": group, "status": status}, 1)
+	}
+}
+
+func countBackendError(ctx *RuntimeContext, backend string) {
+	ctx.metrics.add(metricBackendErrors, map[string]string{"backend": backend}, 1)
+}
+
+func loadMetrics(ctx *RuntimeContext) map[string]*metricSample {
+	samples := make(map[string]*metricSample)
+	data, err := ctx.io.LoadBytes(metricsFile)
+	if err != nil {
+		return samples
+	}
+	if err = json.Unmarshal(data, &samples); err != nil {
+		logWarn(ctx, "", "Unable to parse stored metrics, starting from scratch")
+		return make(map[string]*metricSample)
+	}
+	return samples
+}
+
+// metricsStoredLocally - metrics file is kept only next to CLI runs, Lambda invocations do not share any
+func metricsStoredLocally(ctx *RuntimeContext) bool {
+	_, ok := ctx.io.(*CliIOStrategy)
+	return ok
+}
+
+// lockMetrics takes exclusive lock of metrics file, returned function releases it
+func lockMetrics() (func(), error) {
+	f, err := os.OpenFile(metricsLockFile, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, 0)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// replaceMetricsFile writes samples to temporary file renamed over metrics file, readers see old or new content only
+func replaceMetricsFile(samples map[string]*metricSample) error {
+	data, err := json.Marshal(samples)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	f, err := os.CreateTemp(filepath.Dir(metricsFile), metricsFile+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), metricsFile)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+// exposeStoredMetrics - creates empty metrics file unless it exists, so CLI runs start saving their metrics
+func exposeStoredMetrics(ctx *RuntimeContext) {
+	if !metricsStoredLocally(ctx) {
+		return
+	}
+	unlock, err := lockMetrics()
+	if err == nil {
+		defer unlock()
+		if _, err = os.Stat(metricsFile); os.IsNotExist(err) {
+			err = replaceMetricsFile(make(map[string]*metricSample))
+		}
+	}
+	if err != nil {
+		logError(ctx, "", err, "Unable to create metrics file, metrics of other runs will not be exposed")
+	}
+}
+
+func mergeMetricsFile(ctx *RuntimeContext, taken map[string]*metricSample) error {
+	unlock, err := lockMetrics()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, err = os.Stat(metricsFile); os.IsNotExist(err) {
+		return errMetricsNotExposed
+	}
+	samples := loadMetrics(ctx)
+	(&metricsRegistry{samples: taken}).mergeInto(samples)
+	return replaceMetricsFile(samples)
+}
+
+// SaveMetrics - merges metrics of this run into stored ones when a process exposing /metrics created
+// the metrics file, otherwise (and in Lambda) they are dropped
+func SaveMetrics(ctx *RuntimeContext) {
+	if !metricsStoredLocally(ctx) {
+		return
+	}
+	taken := ctx.metrics.take()
+	if len(taken) == 0 {
+		return
+	}
+	err := mergeMetricsFile(ctx, taken)
+	if err == errMetricsNotExposed {
+		logDebug(ctx, "", "No metrics file, metrics of this run are not saved")
+	} else if err != nil {
+		logError(ctx, "", err, "Unable to save metrics")
+		ctx.metrics.putBack(taken)
+	}
+}
+
+// writeMetrics renders samples in Prometheus text exposition format
+func writeMetrics(samples map[string]*metricSample) []byte {
+	byFamily := make(map[string][]string)
+	for key, sample := range samples {
+		byFamily[sample.Family] = append(byFamily[sample.Family], key)
+	}
+	families := make([]string, 0, len(byFamily))
+	for family := range byFamily {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+
+	var b bytes.Buffer
+	for _, family := range families {
+		if definition, ok := metricFamilies[family]; ok {
+			fmt.Fprintf(&b, "# HELP %s %s\n", family, definition.help)
+			fmt.Fprintf(&b, "# TYPE %s %s\n", family, definition.kind)
+		}
+		keys := byFamily[family]
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&b, "%s %s\n", key, strconv.FormatFloat(samples[key].Value, 'g', -1, 64))
+		}
+	}
+	return b.Bytes()
+}
+
+// metricsHandler serves metrics of this process merged with stored ones, creating metrics file lets CLI runs
+// sharing the directory know somebody reads it
+func metricsHandler(ctx *RuntimeContext) http.HandlerFunc {
+	exposeStoredMetrics(ctx)
+	return func(w http.ResponseWriter, r *http.Request) {
+		samples := loadMetrics(ctx)
+		ctx.metrics.mergeInto(samples)
+		w.Header().Set("Content-Type", metricsContentType)
+		w.Write(writeMetrics(samples))
+	}
+}
+
+// ServeMetrics - exposes /metrics on given address in background (Socket Mode daemon has no HTTP server),
+// address is bound right away so it is reported when taken
+func ServeMetrics(ctx *RuntimeContext, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler(ctx))
+	logInfo(ctx, "", "Metrics listening on %s", addr)
+	go func() {
+		logError(ctx, "", errors.Wrap(http.Serve(listener, mux), 0), "Metrics server stopped")
+	}()
+	return nil
+}
@@ -0,0 +1,46 @@
+package src
+
+import (
+	"os"
+	"testing"
+)
+
+func inTempDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestSaveMetricsOnlyWhenExposed(t *testing.T) {
+	inTempDir(t)
+	run := func() *RuntimeContext {
+		ctx := &RuntimeContext{io: &CliIOStrategy{}, metrics: newMetricsRegistry()}
+		countBackendError(ctx, backendSlack)
+		return ctx
+	}
+	SaveMetrics(run())
+	if _, err := os.Stat(metricsFile); !os.IsNotExist(err) {
+		t.Fatalf("expected no metrics file without exposing process, got %v", err)
+	}
+
+	server := &RuntimeContext{io: &CliIOStrategy{}, metrics: newMetricsRegistry()}
+	exposeStoredMetrics(server)
+	SaveMetrics(run())
+	SaveMetrics(run())
+	samples := loadMetrics(server)
+	key := metricKey(metricBackendErrors, map[string]string{"backend": backendSlack})
+	if sample, ok := samples[key]; !ok || sample.Value != 2 {
+		t.Errorf("expected counters of both runs merged, got %v", samples)
+	}
+
+	// exposing again must not reset stored metrics
+	exposeStoredMetrics(server)
+	if len(loadMetrics(server)) != 1 {
+		t.Error("expected stored metrics to be kept")
+	}
+}
@@ -0,0 +1,99 @@
+package src
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/slack-go/slack"
+)
+
+// notifier types, see NotifierConfig
+const (
+	notifierSlack   = "slack"
+	notifierTeams   = "teams"
+	notifierWebhook = "webhook"
+	notifierEmail   = "email"
+)
+
+// Notifier - place where group announces its schedule and today's assignments
+type Notifier interface {
+	Name() string
+	NotifySchedule(ctx *RuntimeContext, cfg *AssignmentsConfig, schedule []AssignmentsScheduleEntry, title string) error
+	NotifyAssignments(ctx *RuntimeContext, cfg *AssignmentsConfig, day *assignmentDay) error
+}
+
+// notifiersFor returns configured notifiers of group, Slack only when none is configured
+func notifiersFor(ctx *RuntimeContext, cfg *AssignmentsConfig) []Notifier {
+	if len(cfg.Notifiers) == 0 {
+		return []Notifier{&slackNotifier{channel: cfg.NotifyChannel}}
+	}
+	notifiers := make([]Notifier, 0, len(cfg.Notifiers))
+	for _, nc := range cfg.Notifiers {
+		switch nc.Type {
+		case notifierSlack, "":
+			channel := nc.Channel
+			if channel == "" {
+				channel = cfg.NotifyChannel
+			}
+			notifiers = append(notifiers, &slackNotifier{channel: channel})
+		case notifierTeams:
+			notifiers = append(notifiers, &teamsNotifier{webhook: newWebhook(nc)})
+		case notifierWebhook:
+			notifiers = append(notifiers, &webhookNotifier{webhook: newWebhook(nc)})
+		case notifierEmail:
+			notifiers = append(notifiers, &emailNotifier{to: nc.To})
+		default:
+			logWarn(ctx, cfg.GroupName, "Unknown notifier type %s", nc.Type)
+		}
+	}
+	return notifiers
+}
+
+func notifyAssignments(ctx *RuntimeContext, cfg *AssignmentsConfig, day *assignmentDay) {
+	for _, notifier := range notifiersFor(ctx, cfg) {
+		err := notifier.NotifyAssignments(ctx, cfg, day)
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Unable to notify %s about assignments", notifier.Name())
+			countBackendError(ctx, strings.ToLower(notifier.Name()))
+		}
+	}
+}
+
+// slackNotifier - posts schedule to channel and DMs assigned people
+type slackNotifier struct {
+	channel string
+}
+
+func (n *slackNotifier) Name() string {
+	return "Slack"
+}
+
+func (n *slackNotifier) NotifySchedule(ctx *RuntimeContext, cfg *AssignmentsConfig, schedule []AssignmentsScheduleEntry, title string) error {
+	channel := matchChannelToName(ctx, n.channel)
+	if channel == nil {
+		logWarn(ctx, cfg.GroupName, "Skipping missing or nonexisting channel")
+		return nil
+	}
+	blocks, err := scheduleSlackBlocks(ctx, cfg, schedule, title)
+	if err != nil {
+		return err
+	}
+
+	ctx.slack.JoinConversation(channel.ID)
+	_, _, err = ctx.slack.PostMessage(channel.ID, slack.MsgOptionBlocks(blocks...))
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func (n *slackNotifier) NotifyAssignments(ctx *RuntimeContext, cfg *AssignmentsConfig, day *assignmentDay) error {
+	for _, name := range day.Current {
+		user := matchUserToNameGroup(ctx, name)
+		if user == nil {
+			continue
+		}
+		notifyUserInGroup(ctx, user, name, cfg, day)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+const defaultSMTPPort = 587
+
+// emailNotifier - sends schedule to the group list and assignment mails to assigned people
+type emailNotifier struct {
+	to []string
+}
+
+func (n *emailNotifier) Name() string {
+	return "email"
+}
+
+func (n *emailNotifier) NotifySchedule(ctx *RuntimeContext, cfg *AssignmentsConfig, schedule []AssignmentsScheduleEntry, title string) error {
+	if len(n.to) == 0 {
+		logWarn(ctx, cfg.GroupName, "Skipping email notifier without recipients")
+		return nil
+	}
+	text, err := scheduleText(ctx, cfg, schedule, title)
+	if err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("%s %s", cfg.GroupName, title)
+	return sendMail(ctx, n.to, subject, text, scheduleHTML(cfg, schedule, subject))
+}
+
+// NotifyAssignments - mails every assigned person, failure of one mail does not stop the others
+func (n *emailNotifier) NotifyAssignments(ctx *RuntimeContext, cfg *AssignmentsConfig, day *assignmentDay) error {
+	failures := make([]string, 0)
+	for _, name := range day.Current {
+		email := emailOf(ctx, name)
+		if email == "" {
+			logWarn(ctx, cfg.GroupName, "No email address for %s", name.Name)
+			continue
+		}
+		text := fmt.Sprintf("Hi there %s, a quick reminder for you: you have been assigned for %s group on %s!",
+			name.Name, cfg.GroupName, day.Date.Format(format))
+		if cfg.Templates != nil && cfg.Templates.DirectMessage != "" {
+			data := templateDataForDay(ctx, cfg, day)
+			person := toTemplatePerson(ctx, name)
+			data.Person = &person
+			data.Role = name.Group
+			rendered, err := renderTemplate("directMessage", cfg.Templates.DirectMessage, data)
+			if err != nil {
+				logError(ctx, cfg.GroupName, err, "Unable to render email for %s", name.Name)
+				failures = append(failures, name.Name)
+				continue
+			}
+			text = rendered
+		}
+		body := "<p>" + strings.ReplaceAll(html.EscapeString(text), "\n", "<br>\n") + "</p>"
+		err := sendMail(ctx, []string{email}, fmt.Sprintf("%s assignment for %s", cfg.GroupName, day.Date.Format(format)), text, body)
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Unable to send email to %s", name.Name)
+			failures = append(failures, name.Name)
+		}
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("Assignment email failed for: %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// emailOf returns email from spreadsheet (emailsRow) or from identities map
+func emailOf(ctx *RuntimeContext, name NameGroup) string {
+	if name.Email != "" {
+		return name.Email
+	}
+	if email, ok := ctx.Identities[name.Name]; ok {
+		return email
+	}
+	for identity, email := range ctx.Identities {
+		if strings.EqualFold(identity, name.Name) {
+			return email
+		}
+	}
+	return ""
+}
+
+func scheduleHTML(cfg *AssignmentsConfig, schedule []AssignmentsScheduleEntry, title string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<h3>%s</h3>\n<table>\n", html.EscapeString(title))
+	for _, entry := range schedule {
+		if len(entry.Names) == 0 && !isWorkingDay(cfg, entry.Date) {
+			continue
+		}
+		names := make([]string, len(entry.Names))
+		for n, name := range entry.Names {
+			names[n] = html.EscapeString(name.Name)
+		}
+		value := strings.Join(names, ", ")
+		if len(entry.Names) == 0 {
+			if cfg.KeepWhenMissing {
+				value = "<i>same as previous day</i>"
+			} else {
+				value = "<i>nobody is assigned</i>"
+			}
+		}
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td></tr>\n", entry.Date.Format(format), value)
+	}
+	fmt.Fprint(&b, "</table>\n")
+	return b.String()
+}
+
+// sendMail sends multipart (plain text and HTML) message, authenticates only when username is set
+// so local SMTP sinks work without credentials
+func sendMail(ctx *RuntimeContext, to []string, subject, text, htmlBody string) error {
+	if ctx.SMTP == nil || ctx.SMTP.Host == "" {
+		return errors.Errorf("SMTP server is not configured")
+	}
+	port := ctx.SMTP.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	from := ctx.SMTP.From
+	if from == "" {
+		from = ctx.SMTP.Username
+	}
+	var auth smtp.Auth
+	if ctx.SMTP.Username != "" {
+		auth = smtp.PlainAuth("", ctx.SMTP.Username, ctx.SMTP.Password, ctx.SMTP.Host)
+	}
+	message := buildMail(from, to, subject, text, htmlBody, time.Now())
+	err := smtp.SendMail(fmt.Sprintf("%s:%d", ctx.SMTP.Host, port), auth, from, to, message)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func buildMail(from string, to []string, subject, text, htmlBody string, date time.Time) []byte {
+	boundary := fmt.Sprintf("spbot-%d", date.UnixNano())
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprint(&b, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", text},
+		{"text/html", htmlBody},
+	} {
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		fmt.Fprintf(&b, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		fmt.Fprint(&b, "Content-Transfer-Encoding: 8bit\r\n\r\n")
+		fmt.Fprint(&b, strings.ReplaceAll(part.body, "\n", "\r\n"))
+		fmt.Fprint(&b, "\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes()
+}
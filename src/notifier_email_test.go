@@ -0,0 +1,240 @@
+package src
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpMessage - message received by smtpSink
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpSink - minimal SMTP server accepting messages without authentication or TLS,
+// recipients listed in reject are refused
+type smtpSink struct {
+	listener net.Listener
+	reject   map[string]bool
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+func newSMTPSink(t *testing.T, reject ...string) *smtpSink {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &smtpSink{listener: listener, reject: make(map[string]bool)}
+	for _, address := range reject {
+		sink.reject[address] = true
+	}
+	t.Cleanup(func() { listener.Close() })
+	go sink.serve()
+	return sink
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		io.WriteString(conn, line+"\r\n")
+	}
+	reply("220 sink ESMTP")
+	var message smtpMessage
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250-sink")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			from := strings.Fields(line[len("MAIL FROM:"):])[0]
+			message = smtpMessage{from: strings.Trim(from, "<>")}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			address := strings.Trim(line[len("RCPT TO:"):], "<> ")
+			if s.reject[address] {
+				reply("550 No such user")
+				continue
+			}
+			message.to = append(message.to, address)
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			message.data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "RSET", command == "NOOP":
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *smtpSink) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage{}, s.messages...)
+}
+
+func (s *smtpSink) context() *RuntimeContext {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return &RuntimeContext{SMTP: &SMTPConfig{Host: addr.IP.String(), Port: addr.Port, From: "bot@example.com"}}
+}
+
+func TestSendMail(t *testing.T) {
+	sink := newSMTPSink(t)
+	ctx := sink.context()
+	err := sendMail(ctx, []string{"alice@example.com", "bob@example.com"}, "Ops schedule – week 36",
+		"Monday: Alice\nTuesday: Bob", "<p>Monday: Alice<br>\nTuesday: Bob</p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := sink.received()
+	if len(messages) != 1 {
+		t.Fatalf("expected single message, got %d", len(messages))
+	}
+	received := messages[0]
+	if received.from != "bot@example.com" {
+		t.Errorf("unexpected envelope sender %s", received.from)
+	}
+	if strings.Join(received.to, ",") != "alice@example.com,bob@example.com" {
+		t.Errorf("unexpected envelope recipients %v", received.to)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(received.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{
+		"From":         "bot@example.com",
+		"To":           "alice@example.com, bob@example.com",
+		"MIME-Version": "1.0",
+	}
+	for name, expected := range headers {
+		if actual := msg.Header.Get(name); actual != expected {
+			t.Errorf("header %s: expected '%s', got '%s'", name, expected, actual)
+		}
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Ops schedule – week 36" {
+		t.Errorf("unexpected subject '%s' (%v)", subject, err)
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("invalid Date header: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected content type %s (%v)", mediaType, err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	expectedParts := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", "Monday: Alice\r\nTuesday: Bob"},
+		{"text/html; charset=utf-8", "<p>Monday: Alice<br>\r\nTuesday: Bob</p>"},
+	}
+	for _, expected := range expectedParts {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("missing %s part: %v", expected.contentType, err)
+		}
+		if actual := part.Header.Get("Content-Type"); actual != expected.contentType {
+			t.Errorf("expected part %s, got %s", expected.contentType, actual)
+		}
+		body, _ := io.ReadAll(part)
+		if string(body) != expected.body {
+			t.Errorf("%s: expected body %q, got %q", expected.contentType, expected.body, string(body))
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("expected exactly two parts, got %v", err)
+	}
+}
+
+func TestSendMailWithoutSMTP(t *testing.T) {
+	err := sendMail(&RuntimeContext{}, []string{"alice@example.com"}, "subject", "text", "<p>text</p>")
+	if err == nil {
+		t.Error("expected error without SMTP configuration")
+	}
+}
+
+func TestBuildMailBoundaryIsUnique(t *testing.T) {
+	date := time.Date(2022, 9, 5, 9, 0, 0, 0, time.UTC)
+	first := buildMail("bot@example.com", []string{"alice@example.com"}, "subject", "text", "html", date)
+	second := buildMail("bot@example.com", []string{"alice@example.com"}, "subject", "text", "html", date.Add(time.Nanosecond))
+	if string(first) == string(second) {
+		t.Error("expected messages built at different times to differ in boundary")
+	}
+	if !strings.Contains(string(first), "Date: Mon, 05 Sep 2022 09:00:00 +0000\r\n") {
+		t.Errorf("unexpected Date header in %q", string(first))
+	}
+}
+
+func TestEmailNotifyAssignmentsContinuesOnError(t *testing.T) {
+	sink := newSMTPSink(t, "bob@example.com")
+	ctx := sink.context()
+	ctx.Identities = map[string]string{"Carol": "carol@example.com"}
+	cfg := &AssignmentsConfig{GroupName: "Ops"}
+	day := &assignmentDay{
+		Date: time.Date(2022, 9, 5, 0, 0, 0, 0, time.UTC),
+		Current: []NameGroup{
+			{Name: "Alice", Group: "L1", Email: "alice@example.com"},
+			{Name: "Bob", Group: "L1", Email: "bob@example.com"},
+			{Name: "Dave", Group: "L2"},
+			{Name: "Carol", Group: "L2"},
+		},
+	}
+	err := (&emailNotifier{}).NotifyAssignments(ctx, cfg, day)
+	if err == nil || !strings.Contains(err.Error(), "Bob") {
+		t.Errorf("expected error naming Bob, got %v", err)
+	}
+	delivered := make([]string, 0)
+	for _, message := range sink.received() {
+		delivered = append(delivered, message.to...)
+	}
+	if strings.Join(delivered, ",") != "alice@example.com,carol@example.com" {
+		t.Errorf("expected mails to Alice and Carol, got %v", delivered)
+	}
+}
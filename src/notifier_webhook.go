@@ -0,0 +1,185 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+const webhookTimeout = 15 * time.Second
+
+// webhook - incoming webhook URL with optional extra headers (e.g. authorization)
+type webhook struct {
+	url     string
+	headers map[string]string
+}
+
+func newWebhook(nc *NotifierConfig) *webhook {
+	return &webhook{url: nc.URL, headers: nc.Headers}
+}
+
+func (w *webhook) postJSON(payload interface{}) error {
+	if w.url == "" {
+		return errors.Errorf("Missing webhook URL")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("Webhook failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func joinNames(names []NameGroup) string {
+	if len(names) == 0 {
+		return "-"
+	}
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		if name.Group != "" {
+			parts = append(parts, fmt.Sprintf("%s (%s)", name.Name, name.Group))
+		} else {
+			parts = append(parts, name.Name)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// teamsNotifier - posts Adaptive Card to Microsoft Teams incoming webhook
+type teamsNotifier struct {
+	webhook *webhook
+}
+
+type adaptiveFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+func (n *teamsNotifier) Name() string {
+	return "Microsoft Teams"
+}
+
+func (n *teamsNotifier) post(title string, facts []adaptiveFact) error {
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []interface{}{
+			map[string]interface{}{
+				"type":   "TextBlock",
+				"text":   title,
+				"size":   "Medium",
+				"weight": "Bolder",
+				"wrap":   true,
+			},
+			map[string]interface{}{
+				"type":  "FactSet",
+				"facts": facts,
+			},
+		},
+	}
+	return n.webhook.postJSON(map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content":     card,
+			},
+		},
+	})
+}
+
+func (n *teamsNotifier) NotifySchedule(ctx *RuntimeContext, cfg *AssignmentsConfig, schedule []AssignmentsScheduleEntry, title string) error {
+	facts := make([]adaptiveFact, 0, len(schedule))
+	for _, entry := range schedule {
+		if len(entry.Names) == 0 && !isWorkingDay(cfg, entry.Date) {
+			continue
+		}
+		facts = append(facts, adaptiveFact{Title: entry.Date.Format("Mon 02.01"), Value: joinNames(entry.Names)})
+	}
+	return n.post(fmt.Sprintf("%s: %s", cfg.GroupName, title), facts)
+}
+
+func (n *teamsNotifier) NotifyAssignments(ctx *RuntimeContext, cfg *AssignmentsConfig, day *assignmentDay) error {
+	facts := []adaptiveFact{
+		{Title: "Previous", Value: joinNames(day.Previous)},
+		{Title: "Current", Value: joinNames(day.Current)},
+		{Title: "Next", Value: joinNames(day.Next)},
+	}
+	return n.post(fmt.Sprintf("%s assignments for %s", cfg.GroupName, day.Date.Format("Mon 02.01.2006")), facts)
+}
+
+// webhookNotifier - posts plain JSON events to any endpoint
+type webhookNotifier struct {
+	webhook *webhook
+}
+
+type webhookPerson struct {
+	Name  string `json:"name"`
+	Group string `json:"group,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+type webhookDay struct {
+	Date   string          `json:"date"`
+	People []webhookPerson `json:"people"`
+}
+
+func webhookPeople(names []NameGroup) []webhookPerson {
+	people := make([]webhookPerson, 0, len(names))
+	for _, name := range names {
+		people = append(people, webhookPerson{Name: name.Name, Group: name.Group, Email: name.Email})
+	}
+	return people
+}
+
+func (n *webhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (n *webhookNotifier) NotifySchedule(ctx *RuntimeContext, cfg *AssignmentsConfig, schedule []AssignmentsScheduleEntry, title string) error {
+	days := make([]webhookDay, 0, len(schedule))
+	for _, entry := range schedule {
+		days = append(days, webhookDay{Date: entry.Date.Format("2006-01-02"), People: webhookPeople(entry.Names)})
+	}
+	return n.webhook.postJSON(map[string]interface{}{
+		"event": "schedule",
+		"group": cfg.GroupName,
+		"title": title,
+		"days":  days,
+	})
+}
+
+func (n *webhookNotifier) NotifyAssignments(ctx *RuntimeContext, cfg *AssignmentsConfig, day *assignmentDay) error {
+	return n.webhook.postJSON(map[string]interface{}{
+		"event":    "assignment",
+		"group":    cfg.GroupName,
+		"date":     day.Date.Format("2006-01-02"),
+		"previous": webhookPeople(day.Previous),
+		"current":  webhookPeople(day.Current),
+		"next":     webhookPeople(day.Next),
+	})
+}
@@ -0,0 +1,514 @@
+package src
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agnivade/levenshtein"
+	"github.com/go-errors/errors"
+)
+
+// Opsgenie modes, see OpsgenieConfig
+const (
+	// opsgenieModeRotations - one rotation per shift added to long-lived group schedule
+	opsgenieModeRotations = "rotations"
+	// opsgenieModeOverrides - shifts applied as overrides of long-lived group schedule
+	opsgenieModeOverrides = "overrides"
+)
+
+// rotations and overrides created by this app, anything else in schedules is left intact
+const (
+	opsgenieRotationPrefix = "spbot "
+	opsgenieAliasPrefix    = "spbot-"
+)
+
+type opsgenieShift struct {
+	group string
+	name  string
+	user  *opsgenieUser
+	start time.Time
+	end   time.Time
+}
+
+// opsgeniePlan - desired Opsgenie state computed from spreadsheet
+type opsgeniePlan struct {
+	cfg       *AssignmentsConfig
+	og        *OpsgenieConfig
+	groups    []string
+	shifts    map[string][]*opsgenieShift
+	startDate time.Time
+	endDate   time.Time
+}
+
+type opsgenieAction struct {
+	description string
+	apply       func() error
+}
+
+// LoadOpsgenie -
+func LoadOpsgenie(ctx *RuntimeContext) error {
+	ctx.opsgenie = newOpsgenieClient(ctx.OpsgenieURL, ctx.OpsgenieAPIKey)
+	var err error
+	ctx.ogUsers, err = ctx.opsgenie.listUsers()
+	return err
+}
+
+// minOpsgenieMatchQuality - people matched worse (see VerifyOpsgenieNames) are not paged
+const minOpsgenieMatchQuality = 50
+
+func opsgenieMatchQuality(name string, user *opsgenieUser) float64 {
+	dist := levenshtein.ComputeDistance(name, user.FullName)
+	return 100.0 - math.Min(100.0, math.Round(100.0*float64(dist)/float64(len(name))))
+}
+
+// closestOpsgenieUser returns user with the closest full name, regardless of match quality
+func closestOpsgenieUser(ctx *RuntimeContext, name string) *opsgenieUser {
+	if len(ctx.ogUsers) == 0 {
+		return nil
+	}
+	best := &ctx.ogUsers[0]
+	bestDist := 9999999
+	for n := range ctx.ogUsers {
+		dist := levenshtein.ComputeDistance(ctx.ogUsers[n].FullName, name)
+		if dist < bestDist {
+			bestDist = dist
+			best = &ctx.ogUsers[n]
+		}
+	}
+	return best
+}
+
+// matchOpsgenieUserToName returns closest user, nil when the match is of low quality
+func matchOpsgenieUserToName(ctx *RuntimeContext, name string) *opsgenieUser {
+	user := closestOpsgenieUser(ctx, name)
+	if user == nil || opsgenieMatchQuality(name, user) < minOpsgenieMatchQuality {
+		return nil
+	}
+	return user
+}
+
+// VerifyOpsgenieNames -
+func VerifyOpsgenieNames(ctx *RuntimeContext) {
+	for _, cfg := range ctx.Configs {
+		if cfg.Opsgenie == nil {
+			continue
+		}
+
+		logInfo(ctx, cfg.GroupName, "Verifying Opsgenie names")
+		names, err := getAllNames(ctx, cfg)
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Unable to load names")
+			continue
+		}
+		good := 0
+		lq := 0
+		bad := 0
+		for _, nameAndPos := range names {
+			user := closestOpsgenieUser(ctx, nameAndPos.name)
+			position := fmt.Sprintf("%s:%d", colNoToName(nameAndPos.col), nameAndPos.row)
+			if user == nil {
+				logWarn(ctx, cfg.GroupName, "[%s] %s -> unable to match", position, nameAndPos.name)
+				bad++
+				continue
+			}
+			matchQuality := opsgenieMatchQuality(nameAndPos.name, user)
+			if matchQuality < minOpsgenieMatchQuality {
+				lq++
+				logWarn(ctx, cfg.GroupName, "[%s] %s -> %s (%s), match: %.0f%%, low quality match",
+					position, nameAndPos.name, user.FullName, user.Username, matchQuality)
+				continue
+			}
+			good++
+			logInfo(ctx, cfg.GroupName, "[%s] %s -> %s (%s), match: %.0f%%",
+				position, nameAndPos.name, user.FullName, user.Username, matchQuality)
+		}
+		logInfo(ctx, cfg.GroupName, "%d matches, %d low quality, %d missing", good, lq, bad)
+	}
+}
+
+// OpsgenieAssign - fills Opsgenie schedules and escalations from spreadsheet
+func OpsgenieAssign(ctx *RuntimeContext, startDate, endDate time.Time) {
+	done := startRun(ctx, "assignOpsgenie", "")
+	err := opsgenieAssign(ctx, startDate, endDate)
+	if err != nil {
+		logError(ctx, "", err, "Unable to assign Opsgenie")
+		countBackendError(ctx, backendOpsgenie)
+	}
+	done(err)
+}
+
+func opsgenieAssign(ctx *RuntimeContext, startDate, endDate time.Time) error {
+	for _, cfg := range ctx.Configs {
+		for _, og := range cfg.Opsgenie {
+			logInfo(ctx, cfg.GroupName, "Processing Opsgenie escalation ID='%s'", og.EscalationID)
+			plan, err := planOpsgenie(ctx, cfg, og, startDate, endDate)
+			if err != nil {
+				return err
+			}
+			err = applyOpsgenie(ctx, plan)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func planOpsgenie(
+	ctx *RuntimeContext,
+	cfg *AssignmentsConfig,
+	og *OpsgenieConfig,
+	startDate time.Time,
+	endDate time.Time,
+) (*opsgeniePlan, error) {
+	shift, err := newDutyShift(fmt.Sprintf("Opsgenie escalation id='%s'", og.EscalationID), og.TimeZone, og.ShiftStart, og.ShiftDuration, og.WeekendShift)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, startDate, endDate)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	schedule = shift.days(cfg, schedule)
+
+	plan := &opsgeniePlan{
+		cfg:       cfg,
+		og:        og,
+		groups:    make([]string, len(og.Groups)),
+		shifts:    make(map[string][]*opsgenieShift),
+		startDate: startDate,
+		endDate:   endDate,
+	}
+	copy(plan.groups, og.Groups)
+
+	placement := newPagerDutyPlacement(nil, og.EscalationID, startDate, ctx.Seed)
+	backupSlotsCount := 0
+	for _, entry := range schedule {
+		start, duration := shift.startOf(entry.Date)
+		taken := make(map[string]bool)
+		for _, nameGroup := range placement.order(entry.Names) {
+			if og.Groups != nil && !contains(og.Groups, nameGroup.Group) {
+				continue
+			}
+			user := matchOpsgenieUserToName(ctx, nameGroup.Name)
+			if user == nil {
+				logWarn(ctx, cfg.GroupName, "Unable to match user '%s' to Opsgenie user", nameGroup.Name)
+				continue
+			}
+
+			// own group first, first free backup slot (new one if needed) otherwise
+			slot := nameGroup.Group
+			if taken[slot] {
+				slot = ""
+				for _, backup := range placement.backupOrder(nameGroup.Name, backupSlotsCount+1) {
+					if !taken[backup] {
+						slot = backup
+						break
+					}
+				}
+				if slot == fmt.Sprintf("Backup%d", backupSlotsCount+1) {
+					backupSlotsCount++
+					plan.groups = append(plan.groups, slot)
+				}
+				placement.placedBackup(nameGroup, slot)
+			} else {
+				if !contains(plan.groups, slot) {
+					plan.groups = append(plan.groups, slot)
+				}
+				placement.placedPrimary(nameGroup)
+			}
+			taken[slot] = true
+
+			plan.shifts[slot] = append(plan.shifts[slot], &opsgenieShift{
+				group: slot,
+				name:  nameGroup.Name,
+				user:  user,
+				start: start,
+				end:   start.Add(duration),
+			})
+		}
+	}
+	return plan, nil
+}
+
+func opsgenieScheduleName(og *OpsgenieConfig, group string) string {
+	return og.Prefix + group
+}
+
+func opsgenieShiftKey(username string, start, end time.Time) string {
+	return fmt.Sprintf("%s|%d|%d", username, start.Unix(), end.Unix())
+}
+
+func parseOpsgenieTime(value string) time.Time {
+	parsed, _ := time.Parse(time.RFC3339, value)
+	return parsed
+}
+
+// isOwnOpsgenieRule - rule paging schedule managed by the app
+func isOwnOpsgenieRule(og *OpsgenieConfig, rule opsgenieEscalationRule) bool {
+	return rule.Recipient.Type == "schedule" && strings.HasPrefix(rule.Recipient.Name, og.Prefix)
+}
+
+func applyOpsgenie(ctx *RuntimeContext, plan *opsgeniePlan) error {
+	og := plan.og
+	escalation, err := ctx.opsgenie.getEscalation(og.EscalationID)
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.opsgenie.listSchedules()
+	if err != nil {
+		return err
+	}
+	scheduleIDs := make(map[string]string)
+	for _, schedule := range existing {
+		scheduleIDs[schedule.Name] = schedule.ID
+	}
+
+	// groups (and backup slots) dropped from plan still have rules pointing to their schedules,
+	// their shifts in the range are removed and the rules trimmed, so nobody stale is paged
+	groups := make([]string, len(plan.groups))
+	copy(groups, plan.groups)
+	for _, rule := range escalation.Rules {
+		if !isOwnOpsgenieRule(og, rule) {
+			continue
+		}
+		group := strings.TrimPrefix(rule.Recipient.Name, og.Prefix)
+		if _, ok := scheduleIDs[rule.Recipient.Name]; ok && !contains(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+
+	actions := make([]opsgenieAction, 0)
+	for _, group := range groups {
+		group := group
+		name := opsgenieScheduleName(og, group)
+		if _, ok := scheduleIDs[name]; !ok {
+			actions = append(actions, opsgenieAction{
+				description: fmt.Sprintf("create schedule '%s'", name),
+				apply: func() error {
+					schedule := opsgenieSchedule{Name: name, Timezone: "UTC", Enabled: true}
+					if og.OwnerTeam != "" {
+						schedule.OwnerTeam = &opsgenieRef{Name: og.OwnerTeam}
+					}
+					saved, err := ctx.opsgenie.createSchedule(schedule)
+					if err != nil {
+						return err
+					}
+					scheduleIDs[name] = saved.ID
+					return nil
+				},
+			})
+		}
+
+		var groupActions []opsgenieAction
+		switch og.Mode {
+		case opsgenieModeOverrides:
+			groupActions, err = planOpsgenieOverrides(ctx, plan, group, scheduleIDs)
+		case opsgenieModeRotations, "":
+			groupActions, err = planOpsgenieRotations(ctx, plan, group, scheduleIDs)
+		default:
+			err = errors.Errorf("Unknown mode '%s' for Opsgenie escalation id='%s'", og.Mode, og.EscalationID)
+		}
+		if err != nil {
+			return err
+		}
+		actions = append(actions, groupActions...)
+	}
+
+	// own rules (pointing to prefixed schedules) follow groups order keeping their condition and delay,
+	// extra own rules are removed, missing ones are inserted after the last own rule with increasing delay;
+	// rules of anybody else are kept exactly where they are
+	rules := make([]opsgenieEscalationRule, 0, len(escalation.Rules)+len(plan.groups))
+	rulesChanged := false
+	planned := 0
+	insertAt := -1
+	for _, rule := range escalation.Rules {
+		if !isOwnOpsgenieRule(og, rule) {
+			rules = append(rules, rule)
+			continue
+		}
+		if planned >= len(plan.groups) {
+			rulesChanged = true
+			continue
+		}
+		name := opsgenieScheduleName(og, plan.groups[planned])
+		if rule.Recipient.Name != name {
+			rule.Recipient = opsgenieRef{Type: "schedule", Name: name}
+			rulesChanged = true
+		}
+		rules = append(rules, rule)
+		planned++
+		insertAt = len(rules)
+	}
+	if insertAt < 0 {
+		insertAt = len(rules)
+	}
+	missing := make([]opsgenieEscalationRule, 0)
+	for n := planned; n < len(plan.groups); n++ {
+		missing = append(missing, opsgenieEscalationRule{
+			Condition:  "if-not-acked",
+			NotifyType: "default",
+			Delay:      opsgenieDelay{TimeAmount: 5 * n, TimeUnit: "minutes"},
+			Recipient:  opsgenieRef{Type: "schedule", Name: opsgenieScheduleName(og, plan.groups[n])},
+		})
+	}
+	if len(missing) > 0 {
+		rules = append(rules[:insertAt], append(missing, rules[insertAt:]...)...)
+		rulesChanged = true
+	}
+	if rulesChanged {
+		actions = append(actions, opsgenieAction{
+			description: fmt.Sprintf("point escalation '%s' rules to %d schedule(s) in order: %s", escalation.Name, len(plan.groups), strings.Join(plan.groups, ", ")),
+			apply: func() error {
+				for n := range rules {
+					if isOwnOpsgenieRule(og, rules[n]) {
+						rules[n].Recipient.ID = scheduleIDs[rules[n].Recipient.Name]
+					}
+				}
+				return ctx.opsgenie.updateEscalationRules(og.EscalationID, rules)
+			},
+		})
+	}
+
+	logInfo(ctx, plan.cfg.GroupName, "Fetched escalation '%s' and will perform following actions:", escalation.Name)
+	if len(actions) == 0 {
+		logInfo(ctx, plan.cfg.GroupName, "No changes")
+		return nil
+	}
+	for _, action := range actions {
+		logInfo(ctx, plan.cfg.GroupName, "- %s", action.description)
+	}
+	if !confirmChanges(ctx) {
+		return nil
+	}
+	for n, action := range actions {
+		err = action.apply()
+		if err != nil {
+			return errors.Errorf("%v (%d of %d change(s) applied)", err, n, len(actions))
+		}
+	}
+	logInfo(ctx, plan.cfg.GroupName, "Escalation updated")
+	return nil
+}
+
+// planOpsgenieRotations replaces rotations created for the range, equal ones are kept
+func planOpsgenieRotations(ctx *RuntimeContext, plan *opsgeniePlan, group string, scheduleIDs map[string]string) ([]opsgenieAction, error) {
+	name := opsgenieScheduleName(plan.og, group)
+	desired := make(map[string]*opsgenieShift)
+	for _, shift := range plan.shifts[group] {
+		desired[opsgenieShiftKey(shift.user.Username, shift.start, shift.end)] = shift
+	}
+
+	actions := make([]opsgenieAction, 0)
+	kept := make(map[string]bool)
+	if scheduleID, ok := scheduleIDs[name]; ok {
+		rotations, err := ctx.opsgenie.listRotations(scheduleID)
+		if err != nil {
+			return nil, err
+		}
+		for _, rotation := range rotations {
+			start := parseOpsgenieTime(rotation.StartDate)
+			if !strings.HasPrefix(rotation.Name, opsgenieRotationPrefix) || start.Before(plan.startDate) || !start.Before(plan.endDate) {
+				continue
+			}
+			if len(rotation.Participants) == 1 {
+				key := opsgenieShiftKey(rotation.Participants[0].Username, start, parseOpsgenieTime(rotation.EndDate))
+				if _, ok := desired[key]; ok && !kept[key] {
+					kept[key] = true
+					continue
+				}
+			}
+			rotationID := rotation.ID
+			actions = append(actions, opsgenieAction{
+				description: fmt.Sprintf("delete rotation '%s' in '%s'", rotation.Name, name),
+				apply: func() error {
+					return ctx.opsgenie.deleteRotation(scheduleID, rotationID)
+				},
+			})
+		}
+	}
+
+	for _, shift := range plan.shifts[group] {
+		shift := shift
+		if kept[opsgenieShiftKey(shift.user.Username, shift.start, shift.end)] {
+			continue
+		}
+		rotation := opsgenieRotation{
+			Name:         fmt.Sprintf("%s%s %s", opsgenieRotationPrefix, group, shift.start.Format("2006-01-02 15:04")),
+			StartDate:    shift.start.Format(time.RFC3339),
+			EndDate:      shift.end.Format(time.RFC3339),
+			Type:         "daily",
+			Length:       1,
+			Participants: []opsgenieRef{{Type: "user", Username: shift.user.Username}},
+		}
+		actions = append(actions, opsgenieAction{
+			description: fmt.Sprintf("add rotation in '%s': %s - %s\t%s -> %s", name, rotation.StartDate, rotation.EndDate, shift.name, shift.user.Username),
+			apply: func() error {
+				return ctx.opsgenie.createRotation(scheduleIDs[name], rotation)
+			},
+		})
+	}
+	return actions, nil
+}
+
+// planOpsgenieOverrides puts overrides with stable aliases, stale ones within the range are removed
+func planOpsgenieOverrides(ctx *RuntimeContext, plan *opsgeniePlan, group string, scheduleIDs map[string]string) ([]opsgenieAction, error) {
+	name := opsgenieScheduleName(plan.og, group)
+	desired := make(map[string]opsgenieOverride)
+	aliases := make([]string, 0)
+	for _, shift := range plan.shifts[group] {
+		alias := fmt.Sprintf("%s%s-%d", opsgenieAliasPrefix, strings.ReplaceAll(group, " ", "_"), shift.start.Unix())
+		desired[alias] = opsgenieOverride{
+			Alias:     alias,
+			User:      opsgenieRef{Type: "user", Username: shift.user.Username},
+			StartDate: shift.start.Format(time.RFC3339),
+			EndDate:   shift.end.Format(time.RFC3339),
+		}
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	actions := make([]opsgenieAction, 0)
+	current := make(map[string]bool)
+	if scheduleID, ok := scheduleIDs[name]; ok {
+		overrides, err := ctx.opsgenie.listOverrides(scheduleID)
+		if err != nil {
+			return nil, err
+		}
+		for _, override := range overrides {
+			start := parseOpsgenieTime(override.StartDate)
+			if !strings.HasPrefix(override.Alias, opsgenieAliasPrefix) || start.Before(plan.startDate) || !start.Before(plan.endDate) {
+				continue
+			}
+			if want, ok := desired[override.Alias]; ok {
+				current[override.Alias] = opsgenieShiftKey(want.User.Username, parseOpsgenieTime(want.StartDate), parseOpsgenieTime(want.EndDate)) ==
+					opsgenieShiftKey(override.User.Username, start, parseOpsgenieTime(override.EndDate))
+				continue
+			}
+			alias := override.Alias
+			actions = append(actions, opsgenieAction{
+				description: fmt.Sprintf("remove override in '%s': %s - %s\t%s", name, override.StartDate, override.EndDate, override.User.Username),
+				apply: func() error {
+					return ctx.opsgenie.deleteOverride(scheduleID, alias)
+				},
+			})
+		}
+	}
+
+	for _, alias := range aliases {
+		if current[alias] {
+			continue
+		}
+		override := desired[alias]
+		actions = append(actions, opsgenieAction{
+			description: fmt.Sprintf("put override in '%s': %s - %s\t%s", name, override.StartDate, override.EndDate, override.User.Username),
+			apply: func() error {
+				return ctx.opsgenie.putOverride(scheduleIDs[name], override)
+			},
+		})
+	}
+	return actions, nil
+}
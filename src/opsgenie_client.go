@@ -0,0 +1,229 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+const defaultOpsgenieURL = "https://api.opsgenie.com"
+
+// opsgenieClient - minimal Opsgenie REST API client, base URL can point to EU instance
+// (https://api.eu.opsgenie.com) or to local stand-in
+type opsgenieClient struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+type opsgenieRef struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+type opsgenieUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	FullName string `json:"fullName"`
+}
+
+type opsgenieSchedule struct {
+	ID        string       `json:"id,omitempty"`
+	Name      string       `json:"name"`
+	Timezone  string       `json:"timezone,omitempty"`
+	Enabled   bool         `json:"enabled"`
+	OwnerTeam *opsgenieRef `json:"ownerTeam,omitempty"`
+}
+
+type opsgenieRotation struct {
+	ID           string        `json:"id,omitempty"`
+	Name         string        `json:"name"`
+	StartDate    string        `json:"startDate"`
+	EndDate      string        `json:"endDate,omitempty"`
+	Type         string        `json:"type"`
+	Length       int           `json:"length,omitempty"`
+	Participants []opsgenieRef `json:"participants"`
+}
+
+type opsgenieOverride struct {
+	Alias     string      `json:"alias,omitempty"`
+	User      opsgenieRef `json:"user"`
+	StartDate string      `json:"startDate"`
+	EndDate   string      `json:"endDate"`
+}
+
+type opsgenieDelay struct {
+	TimeAmount int    `json:"timeAmount"`
+	TimeUnit   string `json:"timeUnit,omitempty"`
+}
+
+type opsgenieEscalationRule struct {
+	Condition  string        `json:"condition"`
+	NotifyType string        `json:"notifyType"`
+	Delay      opsgenieDelay `json:"delay"`
+	Recipient  opsgenieRef   `json:"recipient"`
+}
+
+type opsgenieEscalation struct {
+	ID    string                   `json:"id"`
+	Name  string                   `json:"name"`
+	Rules []opsgenieEscalationRule `json:"rules"`
+}
+
+func newOpsgenieClient(baseURL, apiKey string) *opsgenieClient {
+	if baseURL == "" {
+		baseURL = defaultOpsgenieURL
+	}
+	return &opsgenieClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do sends request and decodes "data" of response into out (if given)
+func (c *opsgenieClient) do(method, path string, query url.Values, body interface{}, out interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	req.Header.Set("Authorization", "GenieKey "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("Opsgenie %s %s failed with status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	envelope := struct {
+		Data interface{} `json:"data"`
+	}{Data: out}
+	err = json.Unmarshal(data, &envelope)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func scheduleQuery() url.Values {
+	return url.Values{"scheduleIdentifierType": []string{"id"}}
+}
+
+func (c *opsgenieClient) listUsers() ([]opsgenieUser, error) {
+	users := make([]opsgenieUser, 0)
+	for offset := 0; ; {
+		page := make([]opsgenieUser, 0)
+		query := url.Values{"limit": []string{"100"}, "offset": []string{fmt.Sprint(offset)}}
+		err := c.do(http.MethodGet, "/v2/users", query, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, page...)
+		if len(page) < 100 {
+			break
+		}
+		offset += len(page)
+	}
+	return users, nil
+}
+
+func (c *opsgenieClient) listSchedules() ([]opsgenieSchedule, error) {
+	schedules := make([]opsgenieSchedule, 0)
+	err := c.do(http.MethodGet, "/v2/schedules", nil, nil, &schedules)
+	return schedules, err
+}
+
+func (c *opsgenieClient) createSchedule(schedule opsgenieSchedule) (*opsgenieSchedule, error) {
+	var saved opsgenieSchedule
+	err := c.do(http.MethodPost, "/v2/schedules", nil, schedule, &saved)
+	if err != nil {
+		return nil, err
+	}
+	if saved.Name == "" {
+		saved.Name = schedule.Name
+	}
+	return &saved, nil
+}
+
+func (c *opsgenieClient) listRotations(scheduleID string) ([]opsgenieRotation, error) {
+	rotations := make([]opsgenieRotation, 0)
+	query := url.Values{"identifierType": []string{"id"}}
+	err := c.do(http.MethodGet, "/v2/schedules/"+url.PathEscape(scheduleID)+"/rotations", query, nil, &rotations)
+	return rotations, err
+}
+
+func (c *opsgenieClient) createRotation(scheduleID string, rotation opsgenieRotation) error {
+	return c.do(http.MethodPost, "/v2/schedules/"+url.PathEscape(scheduleID)+"/rotations", scheduleQuery(), rotation, nil)
+}
+
+func (c *opsgenieClient) deleteRotation(scheduleID, rotationID string) error {
+	path := "/v2/schedules/" + url.PathEscape(scheduleID) + "/rotations/" + url.PathEscape(rotationID)
+	return c.do(http.MethodDelete, path, scheduleQuery(), nil, nil)
+}
+
+func (c *opsgenieClient) listOverrides(scheduleID string) ([]opsgenieOverride, error) {
+	overrides := make([]opsgenieOverride, 0)
+	query := url.Values{"scheduleIdentifierType": []string{"id"}}
+	err := c.do(http.MethodGet, "/v2/schedules/"+url.PathEscape(scheduleID)+"/overrides", query, nil, &overrides)
+	return overrides, err
+}
+
+// putOverride creates override with given alias or updates existing one
+func (c *opsgenieClient) putOverride(scheduleID string, override opsgenieOverride) error {
+	path := "/v2/schedules/" + url.PathEscape(scheduleID) + "/overrides/" + url.PathEscape(override.Alias)
+	return c.do(http.MethodPut, path, scheduleQuery(), override, nil)
+}
+
+func (c *opsgenieClient) deleteOverride(scheduleID, alias string) error {
+	path := "/v2/schedules/" + url.PathEscape(scheduleID) + "/overrides/" + url.PathEscape(alias)
+	return c.do(http.MethodDelete, path, scheduleQuery(), nil, nil)
+}
+
+func (c *opsgenieClient) getEscalation(id string) (*opsgenieEscalation, error) {
+	var escalation opsgenieEscalation
+	query := url.Values{"identifierType": []string{"id"}}
+	err := c.do(http.MethodGet, "/v2/escalations/"+url.PathEscape(id), query, nil, &escalation)
+	if err != nil {
+		return nil, err
+	}
+	return &escalation, nil
+}
+
+func (c *opsgenieClient) updateEscalationRules(id string, rules []opsgenieEscalationRule) error {
+	query := url.Values{"identifierType": []string{"id"}}
+	body := map[string]interface{}{"rules": rules}
+	return c.do(http.MethodPatch, "/v2/escalations/"+url.PathEscape(id), query, body, nil)
+}
@@ -0,0 +1,514 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOpsgenie - in-memory stand-in of Opsgenie REST API endpoints used by opsgenieClient
+type fakeOpsgenie struct {
+	mu         sync.Mutex
+	users      []opsgenieUser
+	schedules  []opsgenieSchedule
+	rotations  map[string][]opsgenieRotation
+	overrides  map[string][]opsgenieOverride
+	escalation opsgenieEscalation
+	userPages  []int
+	nextID     int
+}
+
+func newFakeOpsgenie() *fakeOpsgenie {
+	return &fakeOpsgenie{
+		rotations: make(map[string][]opsgenieRotation),
+		overrides: make(map[string][]opsgenieOverride),
+	}
+}
+
+func (f *fakeOpsgenie) id(kind string) string {
+	f.nextID++
+	return fmt.Sprintf("%s-%d", kind, f.nextID)
+}
+
+func (f *fakeOpsgenie) addSchedule(name string) string {
+	id := f.id("schedule")
+	f.schedules = append(f.schedules, opsgenieSchedule{ID: id, Name: name, Enabled: true})
+	return id
+}
+
+func (f *fakeOpsgenie) respond(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func (f *fakeOpsgenie) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("Authorization") != "GenieKey test-key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v2/users":
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		f.userPages = append(f.userPages, offset)
+		end := offset + limit
+		if end > len(f.users) {
+			end = len(f.users)
+		}
+		if offset > len(f.users) {
+			offset = len(f.users)
+		}
+		f.respond(w, f.users[offset:end])
+	case r.Method == http.MethodGet && r.URL.Path == "/v2/schedules":
+		f.respond(w, f.schedules)
+	case r.Method == http.MethodPost && r.URL.Path == "/v2/schedules":
+		var schedule opsgenieSchedule
+		json.NewDecoder(r.Body).Decode(&schedule)
+		schedule.ID = f.id("schedule")
+		f.schedules = append(f.schedules, schedule)
+		f.respond(w, map[string]string{"id": schedule.ID, "name": schedule.Name})
+	case len(parts) == 4 && parts[3] == "rotations" && r.Method == http.MethodGet:
+		f.respond(w, f.rotations[parts[2]])
+	case len(parts) == 4 && parts[3] == "rotations" && r.Method == http.MethodPost:
+		var rotation opsgenieRotation
+		json.NewDecoder(r.Body).Decode(&rotation)
+		rotation.ID = f.id("rotation")
+		f.rotations[parts[2]] = append(f.rotations[parts[2]], rotation)
+		f.respond(w, map[string]string{"id": rotation.ID})
+	case len(parts) == 5 && parts[3] == "rotations" && r.Method == http.MethodDelete:
+		kept := make([]opsgenieRotation, 0)
+		for _, rotation := range f.rotations[parts[2]] {
+			if rotation.ID != parts[4] {
+				kept = append(kept, rotation)
+			}
+		}
+		f.rotations[parts[2]] = kept
+		f.respond(w, nil)
+	case len(parts) == 4 && parts[3] == "overrides" && r.Method == http.MethodGet:
+		f.respond(w, f.overrides[parts[2]])
+	case len(parts) == 5 && parts[3] == "overrides" && r.Method == http.MethodPut:
+		var override opsgenieOverride
+		json.NewDecoder(r.Body).Decode(&override)
+		override.Alias = parts[4]
+		kept := make([]opsgenieOverride, 0)
+		for _, existing := range f.overrides[parts[2]] {
+			if existing.Alias != override.Alias {
+				kept = append(kept, existing)
+			}
+		}
+		f.overrides[parts[2]] = append(kept, override)
+		f.respond(w, map[string]string{"alias": override.Alias})
+	case len(parts) == 5 && parts[3] == "overrides" && r.Method == http.MethodDelete:
+		kept := make([]opsgenieOverride, 0)
+		for _, existing := range f.overrides[parts[2]] {
+			if existing.Alias != parts[4] {
+				kept = append(kept, existing)
+			}
+		}
+		f.overrides[parts[2]] = kept
+		f.respond(w, nil)
+	case len(parts) == 3 && parts[1] == "escalations" && r.Method == http.MethodGet:
+		f.respond(w, f.escalation)
+	case len(parts) == 3 && parts[1] == "escalations" && r.Method == http.MethodPatch:
+		var body struct {
+			Rules []opsgenieEscalationRule `json:"rules"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.escalation.Rules = body.Rules
+		f.respond(w, map[string]string{"id": f.escalation.ID})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func opsgenieTestContext(t *testing.T, fake *fakeOpsgenie) *RuntimeContext {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return &RuntimeContext{
+		AssumeYes: true,
+		opsgenie:  newOpsgenieClient(server.URL, "test-key"),
+		ogUsers: []opsgenieUser{
+			{ID: "u1", Username: "alice@example.com", FullName: "Alice Smith"},
+			{ID: "u2", Username: "bob@example.com", FullName: "Bob Jones"},
+		},
+	}
+}
+
+var opsgenieTestStart = time.Date(2022, 9, 5, 0, 0, 0, 0, time.UTC)
+
+func opsgenieTestShift(group, username string, day int) *opsgenieShift {
+	start := opsgenieTestStart.AddDate(0, 0, day).Add(9 * time.Hour)
+	return &opsgenieShift{
+		group: group,
+		name:  username,
+		user:  &opsgenieUser{Username: username},
+		start: start,
+		end:   start.Add(8 * time.Hour),
+	}
+}
+
+func opsgenieTestRotation(group, username string, day int) opsgenieRotation {
+	shift := opsgenieTestShift(group, username, day)
+	return opsgenieRotation{
+		Name:         fmt.Sprintf("%s%s %s", opsgenieRotationPrefix, group, shift.start.Format("2006-01-02 15:04")),
+		StartDate:    shift.start.Format(time.RFC3339),
+		EndDate:      shift.end.Format(time.RFC3339),
+		Type:         "daily",
+		Participants: []opsgenieRef{{Type: "user", Username: username}},
+	}
+}
+
+func scheduleRule(name string) opsgenieEscalationRule {
+	return opsgenieEscalationRule{Condition: "if-not-acked", NotifyType: "default", Recipient: opsgenieRef{Type: "schedule", Name: name}}
+}
+
+func rotationSummary(rotations []opsgenieRotation) []string {
+	summary := make([]string, len(rotations))
+	for n, rotation := range rotations {
+		summary[n] = fmt.Sprintf("%s %s", rotation.StartDate, rotation.Participants[0].Username)
+	}
+	sort.Strings(summary)
+	return summary
+}
+
+func TestOpsgenieListUsersPagination(t *testing.T) {
+	tests := []struct {
+		name  string
+		users int
+		pages []int
+	}{
+		{name: "no users", users: 0, pages: []int{0}},
+		{name: "single page", users: 42, pages: []int{0}},
+		{name: "exactly full page", users: 100, pages: []int{0, 100}},
+		{name: "several pages", users: 250, pages: []int{0, 100, 200}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeOpsgenie()
+			for n := 0; n < test.users; n++ {
+				fake.users = append(fake.users, opsgenieUser{ID: fmt.Sprint(n), Username: fmt.Sprintf("user%d@example.com", n)})
+			}
+			ctx := opsgenieTestContext(t, fake)
+			users, err := ctx.opsgenie.listUsers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != test.users {
+				t.Errorf("expected %d users, got %d", test.users, len(users))
+			}
+			if fmt.Sprint(fake.userPages) != fmt.Sprint(test.pages) {
+				t.Errorf("expected pages at offsets %v, got %v", test.pages, fake.userPages)
+			}
+		})
+	}
+}
+
+func TestOpsgenieRotationsReconciliation(t *testing.T) {
+	fake := newFakeOpsgenie()
+	l1 := fake.addSchedule("OG L1")
+	backup := fake.addSchedule("OG Backup1")
+	manual := opsgenieRotation{Name: "hand made", StartDate: opsgenieTestStart.Format(time.RFC3339), Participants: []opsgenieRef{{Username: "carol@example.com"}}}
+	fake.rotations[l1] = []opsgenieRotation{
+		// kept, matches plan
+		opsgenieTestRotation("L1", "alice@example.com", 0),
+		// replaced, other person planned
+		opsgenieTestRotation("L1", "alice@example.com", 1),
+		// out of range, kept
+		opsgenieTestRotation("L1", "bob@example.com", 10),
+		// not created by app, kept
+		manual,
+	}
+	// backup slot dropped from plan
+	fake.rotations[backup] = []opsgenieRotation{opsgenieTestRotation("Backup1", "bob@example.com", 0)}
+	fake.escalation = opsgenieEscalation{ID: "esc", Name: "Escalation", Rules: []opsgenieEscalationRule{
+		scheduleRule("OG L1"),
+		scheduleRule("OG Backup1"),
+		{Condition: "if-not-acked", NotifyType: "default", Recipient: opsgenieRef{Type: "user", Username: "boss@example.com"}},
+	}}
+	for n := range fake.rotations[l1] {
+		fake.rotations[l1][n].ID = fake.id("rotation")
+	}
+	fake.rotations[backup][0].ID = fake.id("rotation")
+
+	ctx := opsgenieTestContext(t, fake)
+	plan := &opsgeniePlan{
+		cfg:    &AssignmentsConfig{GroupName: "Ops"},
+		og:     &OpsgenieConfig{EscalationID: "esc", Prefix: "OG ", Groups: []string{"L1", "L2"}},
+		groups: []string{"L1", "L2"},
+		shifts: map[string][]*opsgenieShift{
+			"L1": {opsgenieTestShift("L1", "alice@example.com", 0), opsgenieTestShift("L1", "bob@example.com", 1)},
+			"L2": {opsgenieTestShift("L2", "alice@example.com", 1)},
+		},
+		startDate: opsgenieTestStart,
+		endDate:   opsgenieTestStart.AddDate(0, 0, 7),
+	}
+	err := applyOpsgenie(ctx, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l1Expected := []string{
+		"2022-09-05T09:00:00Z alice@example.com",
+		"2022-09-05T00:00:00Z carol@example.com",
+		"2022-09-06T09:00:00Z bob@example.com",
+		"2022-09-15T09:00:00Z bob@example.com",
+	}
+	sort.Strings(l1Expected)
+	if fmt.Sprint(rotationSummary(fake.rotations[l1])) != fmt.Sprint(l1Expected) {
+		t.Errorf("expected L1 rotations %v, got %v", l1Expected, rotationSummary(fake.rotations[l1]))
+	}
+	if len(fake.rotations[backup]) != 0 {
+		t.Errorf("expected rotations of dropped backup slot to be removed, got %v", rotationSummary(fake.rotations[backup]))
+	}
+
+	var l2 string
+	for _, schedule := range fake.schedules {
+		if schedule.Name == "OG L2" {
+			l2 = schedule.ID
+		}
+	}
+	if l2 == "" {
+		t.Fatal("expected schedule OG L2 to be created")
+	}
+	if fmt.Sprint(rotationSummary(fake.rotations[l2])) != "[2022-09-06T09:00:00Z alice@example.com]" {
+		t.Errorf("unexpected L2 rotations %v", rotationSummary(fake.rotations[l2]))
+	}
+
+	// rules of planned groups in order, rule of dropped slot removed, unrelated rule kept
+	rules := fake.escalation.Rules
+	if len(rules) != 3 {
+		t.Fatalf("expected 3 rules, got %+v", rules)
+	}
+	expectedRecipients := []opsgenieRef{
+		{Type: "schedule", Name: "OG L1", ID: l1},
+		{Type: "schedule", Name: "OG L2", ID: l2},
+		{Type: "user", Username: "boss@example.com"},
+	}
+	for n, expected := range expectedRecipients {
+		if rules[n].Recipient != expected {
+			t.Errorf("rule %d: expected %+v, got %+v", n, expected, rules[n].Recipient)
+		}
+	}
+}
+
+func TestOpsgenieOverridesReconciliation(t *testing.T) {
+	fake := newFakeOpsgenie()
+	l1 := fake.addSchedule("OG L1")
+	backup := fake.addSchedule("OG Backup1")
+	aliasOf := func(group string, day int) string {
+		return fmt.Sprintf("%s%s-%d", opsgenieAliasPrefix, group, opsgenieTestShift(group, "", day).start.Unix())
+	}
+	overrideOf := func(group, username string, day int) opsgenieOverride {
+		shift := opsgenieTestShift(group, username, day)
+		return opsgenieOverride{
+			Alias:     aliasOf(group, day),
+			User:      opsgenieRef{Type: "user", Username: username},
+			StartDate: shift.start.Format(time.RFC3339),
+			EndDate:   shift.end.Format(time.RFC3339),
+		}
+	}
+	fake.overrides[l1] = []opsgenieOverride{
+		overrideOf("L1", "alice@example.com", 0),
+		overrideOf("L1", "alice@example.com", 1),
+		overrideOf("L1", "alice@example.com", 2),
+		{Alias: "manual", User: opsgenieRef{Username: "carol@example.com"}, StartDate: opsgenieTestStart.Format(time.RFC3339)},
+	}
+	fake.overrides[backup] = []opsgenieOverride{overrideOf("Backup1", "bob@example.com", 0)}
+	fake.escalation = opsgenieEscalation{ID: "esc", Name: "Escalation", Rules: []opsgenieEscalationRule{
+		scheduleRule("OG L1"),
+		scheduleRule("OG Backup1"),
+	}}
+
+	ctx := opsgenieTestContext(t, fake)
+	plan := &opsgeniePlan{
+		cfg:    &AssignmentsConfig{GroupName: "Ops"},
+		og:     &OpsgenieConfig{EscalationID: "esc", Prefix: "OG ", Mode: opsgenieModeOverrides},
+		groups: []string{"L1"},
+		shifts: map[string][]*opsgenieShift{
+			"L1": {opsgenieTestShift("L1", "alice@example.com", 0), opsgenieTestShift("L1", "bob@example.com", 1)},
+		},
+		startDate: opsgenieTestStart,
+		endDate:   opsgenieTestStart.AddDate(0, 0, 7),
+	}
+	err := applyOpsgenie(ctx, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := make(map[string]string)
+	for _, override := range fake.overrides[l1] {
+		actual[override.Alias] = override.User.Username
+	}
+	expected := map[string]string{
+		aliasOf("L1", 0): "alice@example.com",
+		aliasOf("L1", 1): "bob@example.com",
+		"manual":         "carol@example.com",
+	}
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("expected L1 overrides %v, got %v", expected, actual)
+	}
+	if len(fake.overrides[backup]) != 0 {
+		t.Errorf("expected overrides of dropped backup slot to be removed, got %+v", fake.overrides[backup])
+	}
+	if len(fake.escalation.Rules) != 1 || fake.escalation.Rules[0].Recipient.ID != l1 {
+		t.Errorf("expected single rule pointing to L1, got %+v", fake.escalation.Rules)
+	}
+}
+
+func TestOpsgenieEscalationUnchanged(t *testing.T) {
+	fake := newFakeOpsgenie()
+	l1 := fake.addSchedule("OG L1")
+	fake.rotations[l1] = []opsgenieRotation{opsgenieTestRotation("L1", "alice@example.com", 0)}
+	fake.escalation = opsgenieEscalation{ID: "esc", Name: "Escalation", Rules: []opsgenieEscalationRule{scheduleRule("OG L1")}}
+	fake.escalation.Rules[0].Recipient.ID = l1
+
+	ctx := opsgenieTestContext(t, fake)
+	plan := &opsgeniePlan{
+		cfg:       &AssignmentsConfig{GroupName: "Ops"},
+		og:        &OpsgenieConfig{EscalationID: "esc", Prefix: "OG "},
+		groups:    []string{"L1"},
+		shifts:    map[string][]*opsgenieShift{"L1": {opsgenieTestShift("L1", "alice@example.com", 0)}},
+		startDate: opsgenieTestStart,
+		endDate:   opsgenieTestStart.AddDate(0, 0, 7),
+	}
+	// any write would fail, nothing is expected to change
+	ctx.AssumeYes = false
+	ctx.PlanOut = "plan only"
+	err := applyOpsgenie(ctx, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.rotations[l1]) != 1 || len(fake.escalation.Rules) != 1 {
+		t.Errorf("expected no changes, got rotations %v and rules %+v", rotationSummary(fake.rotations[l1]), fake.escalation.Rules)
+	}
+}
+
+func TestOpsgenieEscalationRulesKeepForeignRules(t *testing.T) {
+	boss := opsgenieEscalationRule{Condition: "if-not-acked", NotifyType: "default", Recipient: opsgenieRef{Type: "user", Username: "boss@example.com"}}
+	team := opsgenieEscalationRule{Condition: "if-not-closed", NotifyType: "all", Delay: opsgenieDelay{TimeAmount: 30, TimeUnit: "minutes"}, Recipient: opsgenieRef{Type: "team", Name: "SRE"}}
+	own := scheduleRule("OG L1")
+	own.Delay = opsgenieDelay{TimeAmount: 1, TimeUnit: "minutes"}
+	tests := []struct {
+		name     string
+		rules    []opsgenieEscalationRule
+		groups   []string
+		expected []string
+	}{
+		{
+			name:     "foreign rule before own ones, more groups than own rules",
+			rules:    []opsgenieEscalationRule{boss, own, team},
+			groups:   []string{"L1", "L2", "Backup1"},
+			expected: []string{"user boss@example.com", "schedule OG L1", "schedule OG L2", "schedule OG Backup1", "team SRE"},
+		},
+		{
+			name:     "no own rules yet",
+			rules:    []opsgenieEscalationRule{boss, team},
+			groups:   []string{"L1"},
+			expected: []string{"user boss@example.com", "team SRE", "schedule OG L1"},
+		},
+		{
+			name:     "own rule repointed in place",
+			rules:    []opsgenieEscalationRule{team, scheduleRule("OG Backup1"), boss},
+			groups:   []string{"L1"},
+			expected: []string{"team SRE", "schedule OG L1", "user boss@example.com"},
+		},
+		{
+			name:     "nothing planned trims own rules",
+			rules:    []opsgenieEscalationRule{boss, own, scheduleRule("OG Backup1")},
+			groups:   []string{},
+			expected: []string{"user boss@example.com"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeOpsgenie()
+			l1 := fake.addSchedule("OG L1")
+			fake.addSchedule("OG Backup1")
+			fake.rotations[l1] = []opsgenieRotation{opsgenieTestRotation("L1", "alice@example.com", 0)}
+			fake.rotations[l1][0].ID = fake.id("rotation")
+			fake.escalation = opsgenieEscalation{ID: "esc", Name: "Escalation", Rules: append([]opsgenieEscalationRule{}, test.rules...)}
+
+			ctx := opsgenieTestContext(t, fake)
+			shifts := make(map[string][]*opsgenieShift)
+			for _, group := range test.groups {
+				shifts[group] = []*opsgenieShift{opsgenieTestShift(group, "alice@example.com", 0)}
+			}
+			plan := &opsgeniePlan{
+				cfg:       &AssignmentsConfig{GroupName: "Ops"},
+				og:        &OpsgenieConfig{EscalationID: "esc", Prefix: "OG "},
+				groups:    test.groups,
+				shifts:    shifts,
+				startDate: opsgenieTestStart,
+				endDate:   opsgenieTestStart.AddDate(0, 0, 7),
+			}
+			err := applyOpsgenie(ctx, plan)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := make([]string, len(fake.escalation.Rules))
+			for n, rule := range fake.escalation.Rules {
+				recipient := rule.Recipient.Name
+				if recipient == "" {
+					recipient = rule.Recipient.Username
+				}
+				actual[n] = rule.Recipient.Type + " " + recipient
+				if rule.Recipient.Type == "schedule" && rule.Recipient.ID == "" {
+					t.Errorf("rule %d: schedule '%s' without ID", n, recipient)
+				}
+			}
+			if fmt.Sprint(actual) != fmt.Sprint(test.expected) {
+				t.Errorf("expected rules %v, got %v", test.expected, actual)
+			}
+			for _, rule := range fake.escalation.Rules {
+				if rule.Recipient == boss.Recipient && rule != boss || rule.Recipient == team.Recipient && rule != team {
+					t.Errorf("foreign rule changed: %+v", rule)
+				}
+				if rule.Recipient.Name == "OG L1" && test.rules[1] == own && rule.Delay != own.Delay {
+					t.Errorf("own rule lost its delay: %+v", rule)
+				}
+			}
+			if len(test.groups) == 0 && len(fake.rotations[l1]) != 0 {
+				t.Errorf("expected rotations of unplanned group to be removed, got %v", rotationSummary(fake.rotations[l1]))
+			}
+		})
+	}
+}
+
+func TestMatchOpsgenieUserToName(t *testing.T) {
+	ctx := &RuntimeContext{ogUsers: []opsgenieUser{
+		{Username: "alice@example.com", FullName: "Alice Smith"},
+		{Username: "bob@example.com", FullName: "Bob Jones"},
+	}}
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "Alice Smith", expected: "alice@example.com"},
+		{name: "Alice Smyth", expected: "alice@example.com"},
+		{name: "Bob Jones", expected: "bob@example.com"},
+		{name: "Zygmunt Wielki", expected: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user := matchOpsgenieUserToName(ctx, test.name)
+			actual := ""
+			if user != nil {
+				actual = user.Username
+			}
+			if actual != test.expected {
+				t.Errorf("expected '%s', got '%s'", test.expected, actual)
+			}
+		})
+	}
+}
@@ -1,12 +1,8 @@
 package src
 
 import (
-	"bufio"
 	"fmt"
-	"log"
 	"math"
-	"math/rand"
-	"os"
 	"strings"
 	"time"
 
@@ -24,56 +20,48 @@ func VerifyPagerDutyNames(ctx *RuntimeContext) {
 			continue
 		}
 
-		fmt.Println("Verifying names for", cfg.GroupName)
+		logInfo(ctx, cfg.GroupName, "Verifying names")
 		names, err := getAllNames(ctx, cfg)
 		if err != nil {
-			log.Println(Stack(err))
-			log.Println("Unable to load names for", cfg.GroupName)
+			logError(ctx, cfg.GroupName, err, "Unable to load names")
 			continue
 		}
 		good := 0
 		lq := 0
 		bad := 0
 		for _, nameAndPos := range names {
-			user := matchPDUserToName(ctx, nameAndPos.name)
+			user := matchPDUserToName(ctx, nameAndPos.name, configTeams(cfg))
+			position := fmt.Sprintf("%s:%d", colNoToName(nameAndPos.col), nameAndPos.row)
 			if user == nil {
-				fmt.Printf("[%s:%d] %s -> \033[0;31munable to match!\033[0m\n",
-					colNoToName(nameAndPos.col),
-					nameAndPos.row,
-					nameAndPos.name,
-				)
+				logWarn(ctx, cfg.GroupName, "[%s] %s -> unable to match", position, nameAndPos.name)
 				bad++
-			} else {
-				dist := levenshtein.ComputeDistance(nameAndPos.name, user.Name)
-				matchQuality := 100.0 - math.Min(100.0, math.Round(100.0*float64(dist)/float64(len(nameAndPos.name))))
-				fmt.Printf("[%s:%d] %s -> %s (@%s), match: %.0f%%%s\n",
-					colNoToName(nameAndPos.col),
-					nameAndPos.row,
-					nameAndPos.name,
-					user.Name,
-					user.APIObject.ID,
-					matchQuality,
-					(func() string {
-						if matchQuality < 50 {
-							lq++
-							return " \033[0;31mwarning! low quality match\033[0m"
-						}
-						good++
-						return ""
-					})(),
-				)
+				continue
+			}
+			dist := levenshtein.ComputeDistance(nameAndPos.name, user.Name)
+			matchQuality := 100.0 - math.Min(100.0, math.Round(100.0*float64(dist)/float64(len(nameAndPos.name))))
+			if matchQuality < 50 {
+				lq++
+				logWarn(ctx, cfg.GroupName, "[%s] %s -> %s (@%s), match: %.0f%%, low quality match",
+					position, nameAndPos.name, user.Name, user.APIObject.ID, matchQuality)
+				continue
 			}
+			good++
+			logInfo(ctx, cfg.GroupName, "[%s] %s -> %s (@%s), match: %.0f%%",
+				position, nameAndPos.name, user.Name, user.APIObject.ID, matchQuality)
 		}
-		fmt.Println(good, "matches,", lq, "low quality,", bad, "missing")
+		logInfo(ctx, cfg.GroupName, "%d matches, %d low quality, %d missing", good, lq, bad)
 	}
 }
 
 // PagerDutyAssignTiers -
 func PagerDutyAssignTiers(ctx *RuntimeContext, startDate, endDate time.Time) {
+	done := startRun(ctx, "assignPagerDuty", "")
 	err := pagerDutyAssignTiers(ctx, startDate, endDate)
 	if err != nil {
-		log.Println(Stack(err))
+		logError(ctx, "", err, "Unable to assign PagerDuty tiers")
+		countBackendError(ctx, backendPagerDuty)
 	}
+	done(err)
 }
 
 func contains(s []string, e string) bool {
@@ -85,308 +73,489 @@ func contains(s []string, e string) bool {
 	return false
 }
 
+// pagerDutyPlan - desired layout of policy tiers computed from spreadsheet
+type pagerDutyPlan struct {
+	cfg             *AssignmentsConfig
+	pd              *PagerDutyConfig
+	groups          []string
+	assignments     map[string]*PagerDutyTierAssignment
+	tierAssignments [][]*PagerDutyTierAssignment
+	placement       *pagerDutyPlacement
+	startDate       time.Time
+	endDate         time.Time
+}
+
+// errPagerDutyAborted - changes were not confirmed, nothing was applied
+var errPagerDutyAborted = errors.New("aborted")
+
 func pagerDutyAssignTiers(ctx *RuntimeContext, startDate, endDate time.Time) error {
-	now := time.Now()
-	s1 := rand.NewSource(now.UnixNano())
-	r1 := rand.New(s1)
+	history := loadPagerDutyHistory(ctx)
+	saved := &pagerDutySavedPlan{
+		StartDate: startDate,
+		EndDate:   endDate,
+		Seed:      ctx.Seed,
+	}
 
 	for _, cfg := range ctx.Configs {
 		if cfg.PagerDuty == nil {
 			continue
 		}
 		for _, pd := range cfg.PagerDuty {
-			// load phase
-			policyID := pd.PolicyID
-			filterGroups := pd.Groups
-			tierIDs := pd.TierIDs
-			prefix := pd.Prefix
-
-			fmt.Printf("Processing policy ID='%s' for group '%s'.\n", policyID, cfg.GroupName)
+			logInfo(ctx, cfg.GroupName, "Processing policy ID='%s'", pd.PolicyID)
 
-			// get schedule
-			schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, startDate, endDate)
+			placement := newPagerDutyPlacement(history, pd.PolicyID, startDate, ctx.Seed)
+			plan, err := planPagerDutyTiers(ctx, cfg, pd, startDate, endDate, placement)
 			if err != nil {
-				return errors.Wrap(err, 0)
+				return err
 			}
+			logPagerDutyLayout(ctx, plan)
+			saved.Policies = append(saved.Policies, savedPolicyFromPlan(plan))
 
-			// init slots per group (for validation)
-			slotsPerGroup := make(map[string]int)
-			for _, group := range filterGroups {
-				slotsPerGroup[group] = 0
+			err = applyPagerDutyPlan(ctx, plan, history)
+			if err != nil {
+				return err
 			}
+		}
+	}
 
-			// calculate slots per group and max slots per day
-			maxPerDay := 0
-			for _, entry := range schedule {
-				currentMaxPerDay := 0
-				for _, nameGroup := range entry.Names {
-					slotsPerGroup[nameGroup.Group]++
-					if filterGroups != nil && !contains(filterGroups, nameGroup.Group) {
-						continue
-					}
-					currentMaxPerDay++
-				}
-				if currentMaxPerDay > maxPerDay {
-					maxPerDay = currentMaxPerDay
-				}
-			}
+	if ctx.PlanOut != "" {
+		return savePagerDutyPlan(ctx, saved)
+	}
+	return nil
+}
 
-			// verify max slots per day > tier capacity - fatal
-			if len(tierIDs)*5 < maxPerDay {
-				return errors.Errorf(
-					"Schedule for policy id='%s' has up to %d people per day but it contains only %d tiers, %d tiers is required",
-					policyID,
-					maxPerDay,
-					len(tierIDs),
-					1+maxPerDay/5,
-				)
-			}
+// applyPagerDutyPlan brings policy to planned state and records backup duty once applied
+func applyPagerDutyPlan(ctx *RuntimeContext, plan *pagerDutyPlan, history pagerDutyHistory) error {
+	pd := plan.pd
+
+	// get policy
+	var opts pagerduty.GetEscalationPolicyOptions
+	policy, err := ctx.pagerduty.GetEscalationPolicy(pd.PolicyID, &opts)
+	if err != nil {
+		return errors.Errorf("No policy id='%s'", pd.PolicyID)
+	}
+	policy.Teams = nil
+
+	switch pd.Mode {
+	case pagerDutyModeOverrides:
+		err = applyPagerDutyOverrides(ctx, plan, policy)
+	case pagerDutyModeSchedules, "":
+		err = applyPagerDutySchedules(ctx, plan, policy)
+	default:
+		err = errors.Errorf("Unknown mode '%s' for policy id='%s'", pd.Mode, pd.PolicyID)
+	}
+	if err == errPagerDutyAborted {
+		return nil
+	}
+	if err != nil || ctx.PlanOut != "" {
+		return err
+	}
+
+	// backup duty is counted only once it is applied
+	history.record(pd.PolicyID, plan.startDate, plan.placement.planned)
+	err = savePagerDutyHistory(ctx, history)
+	if err == errNoStateStorage {
+		logWarn(ctx, plan.cfg.GroupName, "No state storage, backup duty of this week is not counted for future weeks")
+		return nil
+	} else if err != nil {
+		logError(ctx, plan.cfg.GroupName, err, "Unable to save PagerDuty history")
+	}
+	err = savePagerDutyAppliedPlan(ctx, plan)
+	if err != nil {
+		logError(ctx, plan.cfg.GroupName, err, "Unable to save applied PagerDuty plan, tiers of this week will not be verified")
+	}
+	return nil
+}
+
+func planPagerDutyTiers(
+	ctx *RuntimeContext,
+	cfg *AssignmentsConfig,
+	pd *PagerDutyConfig,
+	startDate time.Time,
+	endDate time.Time,
+	placement *pagerDutyPlacement,
+) (*pagerDutyPlan, error) {
+	// load phase
+	filterGroups := pd.Groups
+	tierIDs := pd.TierIDs
+
+	shift, err := pagerDutyShiftFor(pd)
+	if err != nil {
+		return nil, err
+	}
+
+	// get schedule
+	schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, startDate, endDate)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	schedule = shift.days(cfg, schedule)
+
+	// init slots per group (for validation)
+	slotsPerGroup := make(map[string]int)
+	for _, group := range filterGroups {
+		slotsPerGroup[group] = 0
+	}
 
-			// extend max slot so all tiers are covered
-			if len(tierIDs) > maxPerDay {
-				maxPerDay = len(tierIDs)
+	// calculate slots per group and max slots per day
+	maxPerDay := 0
+	for _, entry := range schedule {
+		currentMaxPerDay := 0
+		for _, nameGroup := range entry.Names {
+			slotsPerGroup[nameGroup.Group]++
+			if filterGroups != nil && !contains(filterGroups, nameGroup.Group) {
+				continue
 			}
+			currentMaxPerDay++
+		}
+		if currentMaxPerDay > maxPerDay {
+			maxPerDay = currentMaxPerDay
+		}
+	}
 
-			// create groups, copy named groups
-			var groups []string = make([]string, 0, maxPerDay)
-			for _, group := range filterGroups {
-				if slotsPerGroup[group] > 0 {
-					groups = append(groups, group)
-				} else {
-					fmt.Printf("Warning: empty group '%s', dropping.\n", group)
-				}
+	// extend max slot so all tiers are covered
+	if len(tierIDs) > maxPerDay {
+		maxPerDay = len(tierIDs)
+	}
+
+	// create groups, copy named groups
+	var groups []string = make([]string, 0, maxPerDay)
+	for _, group := range filterGroups {
+		if slotsPerGroup[group] > 0 {
+			groups = append(groups, group)
+		} else {
+			logWarn(ctx, cfg.GroupName, "Empty group '%s', dropping", group)
+		}
+	}
+
+	// append backup groups
+	i := len(groups)
+	backupSlotsCount := 1
+	for i < maxPerDay {
+		groups = append(groups, fmt.Sprintf("Backup%d", backupSlotsCount))
+		i++
+		backupSlotsCount++
+	}
+	backupSlotsCount--
+
+	// prepare assignment map
+	assignments := make(map[string]*PagerDutyTierAssignment)
+	for _, group := range groups {
+		assignments[group] = &PagerDutyTierAssignment{
+			Group:       group,
+			Assignments: nil,
+		}
+	}
+
+	// fill assignment map
+	for _, entry := range schedule {
+		start, duration := shift.startOf(entry.Date)
+		dayOfWeek := isoWeekday(start)
+		for _, nameGroup := range placement.order(entry.Names) {
+			// skip users (filter by group)
+			if filterGroups != nil && !contains(filterGroups, nameGroup.Group) {
+				continue
+			}
+			// match user to PD
+			match := matchPDUserToName(ctx, nameGroup.Name, pd.Teams)
+			if match == nil {
+				logWarn(ctx, cfg.GroupName, "Unable to match user '%s' to PagerDuty user", nameGroup.Name)
+				continue
 			}
 
-			// append backup groups
-			i := len(groups)
-			backupSlotsCount := 1
-			for i < maxPerDay {
-				groups = append(groups, fmt.Sprintf("Backup%d", backupSlotsCount))
-				i++
-				backupSlotsCount++
+			// create assignment
+			assignment := &PagerDutySlotAssignment{
+				DayOfWeek: dayOfWeek,
+				User:      fmt.Sprintf("%s|%s -> %s", match.APIObject.ID, nameGroup.Name, match.Name),
+				StartUtc:  start.Format("15:04:05"),
+				Start:     start,
+				Duration:  duration,
+				Group:     nameGroup.Group,
 			}
-			backupSlotsCount--
-
-			// prepare assignment map
-			assignments := make(map[string]*PagerDutyTierAssignment)
-			for _, group := range groups {
-				assignments[group] = &PagerDutyTierAssignment{
-					Group:       group,
-					Assignments: nil,
+			// try to assign to primary group
+			moveToTier2 := false
+			for _, assignment := range assignments[nameGroup.Group].Assignments {
+				if assignment.DayOfWeek == dayOfWeek {
+					moveToTier2 = true
+					break
 				}
 			}
-
-			// fill assignment map
-			for _, entry := range schedule {
-				dayOfWeek := uint(entry.Date.Weekday())
-				r1.Shuffle(len(entry.Names), func(i, j int) { entry.Names[i], entry.Names[j] = entry.Names[j], entry.Names[i] })
-				for _, nameGroup := range entry.Names {
-					// skip users (filter by group)
-					if filterGroups != nil && !contains(filterGroups, nameGroup.Group) {
-						// fmt.Printf("Skipped '%s', group='%s'\n", nameGroup.Name, nameGroup.Group)
-						continue
-					}
-					// match user to PD
-					match := matchPDUserToName(ctx, nameGroup.Name)
-					if match == nil {
-						fmt.Printf("Unable to match user '%s' to PagerDuty user\n", nameGroup.Name)
-						continue
-					}
-
-					location, err := time.LoadLocation("Europe/Warsaw")
-					if err != nil {
-						location = time.UTC
-					}
-					timeInLocal := time.Date(now.Year(), now.Month(), now.Day(), 16, 0, 0, 0, location)
-
-					// create assignment
-					assignment := &PagerDutySlotAssignment{
-						DayOfWeek: dayOfWeek,
-						User:      fmt.Sprintf("%s|%s -> %s", match.APIObject.ID, nameGroup.Name, match.Name),
-						StartUtc:  timeInLocal.In(time.UTC).Format("15:04:05"),
-					}
-					// try to assign to primary group
-					moveToTier2 := false
-					for _, assignment := range assignments[nameGroup.Group].Assignments {
+			// fallback to backup group
+			if moveToTier2 {
+				success := false
+				for _, groupName := range placement.backupOrder(nameGroup.Name, backupSlotsCount) {
+					isFree := true
+					for _, assignment := range assignments[groupName].Assignments {
 						if assignment.DayOfWeek == dayOfWeek {
-							moveToTier2 = true
+							isFree = false
 							break
 						}
 					}
-					// fallback to backup group
-					if moveToTier2 {
-						success := false
-						for i := 0; i < backupSlotsCount; i++ {
-							groupName := fmt.Sprintf("Backup%d", i+1)
-							isFree := true
-							for _, assignment := range assignments[groupName].Assignments {
-								if assignment.DayOfWeek == dayOfWeek {
-									isFree = false
-									break
-								}
-							}
-							if isFree {
-								assignments[groupName].Assignments = append(
-									assignments[groupName].Assignments,
-									assignment,
-								)
-								success = true
-								break
-							}
-						}
-						if !success {
-							fmt.Printf("Unable to assign user '%s' on %s - missing slots\n", nameGroup.Name, entry.Date.Format("Jan _2"))
-						}
-					} else {
-						assignments[nameGroup.Group].Assignments = append(
-							assignments[nameGroup.Group].Assignments,
+					if isFree {
+						assignments[groupName].Assignments = append(
+							assignments[groupName].Assignments,
 							assignment,
 						)
+						placement.placedBackup(nameGroup, groupName)
+						success = true
+						break
 					}
 				}
-			}
-
-			// distribute assignments across tiers
-			tierAssignments := make([][]*PagerDutyTierAssignment, len(tierIDs))
-			hadEmptyTier := false
-			groupCnt := 0
-			for n := range tierIDs {
-				for i := 0; i < 5 && groupCnt < len(groups); i++ {
-					tierAssignments[n] = append(tierAssignments[n], assignments[groups[groupCnt]])
-					groupCnt++
+				if !success {
+					logWarn(ctx, cfg.GroupName, "Unable to assign user '%s' on %s - missing slots", nameGroup.Name, entry.Date.Format("Jan _2"))
 				}
+			} else {
+				assignments[nameGroup.Group].Assignments = append(
+					assignments[nameGroup.Group].Assignments,
+					assignment,
+				)
+				placement.placedPrimary(nameGroup)
 			}
-			for i := 0; i < len(tierAssignments); i++ {
-				hadEmptyTier = false
-				for n, s := range tierAssignments {
-					if len(s) != 0 {
-						continue
-					}
-					hadEmptyTier = true
-					maxLen := 0
-					maxSliceIndex := 0
-					for m, s2 := range tierAssignments {
-						if len(s2) > maxLen {
-							maxLen = len(s2)
-							maxSliceIndex = m
-						}
-					}
-					tierAssignments[n] = append(tierAssignments[n], tierAssignments[maxSliceIndex][maxLen-1])
-					tierAssignments[maxSliceIndex] = tierAssignments[maxSliceIndex][:maxLen-1]
-					break
-				}
+		}
+	}
 
-				if !hadEmptyTier {
-					break
-				}
-			}
+	// distribute assignments across tiers
+	tierAssignments, err := distributePagerDutyTiers(pd, groups, assignments)
+	if err != nil {
+		return nil, err
+	}
 
-			if hadEmptyTier {
-				return errors.Errorf("Unable to distribute assignments for policy id='%s'", policyID)
-			}
+	return &pagerDutyPlan{
+		cfg:             cfg,
+		pd:              pd,
+		groups:          groups,
+		assignments:     assignments,
+		tierAssignments: tierAssignments,
+		placement:       placement,
+		startDate:       startDate,
+		endDate:         endDate,
+	}, nil
+}
 
-			// get policy
-			var opts pagerduty.GetEscalationPolicyOptions
-			policy, err := ctx.pagerduty.GetEscalationPolicy(policyID, &opts)
-			policy.Teams = nil
+// confirmChanges asks user (through IOStrategy) unless changes are confirmed
+// upfront with -yes, changes are never applied when plan is only written out
+func confirmChanges(ctx *RuntimeContext) bool {
+	if ctx.PlanOut != "" {
+		logInfo(ctx, "", "Plan only, not applying.")
+		return false
+	}
+	if !ctx.AssumeYes {
+		fmt.Printf("Proceed? [y/N] ")
 
+		input, err := ctx.io.Prompt()
+		if err != nil || len(input) < 1 || (input[0] != 'y' && input[0] != 'Y') {
 			if err != nil {
-				return errors.Errorf("No policy id='%s'", policyID)
+				logError(ctx, "", err, "Unable to confirm changes")
 			}
+			logInfo(ctx, "", "Aborting.")
+			return false
+		}
+	}
+
+	logInfo(ctx, "", "Proceeding")
+	return true
+}
 
-			// clear old schedules from policy
-			oldSchedules, err := clearAutoSchedules(ctx, policy, prefix)
+func logPagerDutySlotLayers(ctx *RuntimeContext, group string, assignments []*PagerDutySlotAssignment) {
+	for l := range assignments {
+		logInfo(ctx, group,
+			"  - layer '%s' starting at %s@UTC for %s: %s",
+			daysOfWeek[assignments[l].DayOfWeek%7],
+			assignments[l].StartUtc,
+			slotDuration(assignments[l]),
+			assignments[l].User,
+		)
+	}
+}
 
-			if err != nil {
-				return err
-			}
+// pagerDutySlotChange - action required to bring slot schedule to desired state
+type pagerDutySlotChange struct {
+	tier     *PagerDutyTierAssignment
+	existing *pagerduty.Schedule
+	schedule pagerduty.Schedule
+	create   bool
+	update   bool
+}
 
-			for _, group := range groups {
-				assignments[group].SlotName = fmt.Sprintf("Slot_%s_%s%s_%06X", policy.Name, prefix, group, r1.Intn(1<<24))
-			}
+func applyPagerDutySchedules(ctx *RuntimeContext, plan *pagerDutyPlan, policy *pagerduty.EscalationPolicy) error {
+	prefix := plan.pd.Prefix
+	tierIDs := plan.pd.TierIDs
+	slotPrefix := fmt.Sprintf("Slot_%s_%s", policy.Name, prefix)
 
-			fmt.Printf("Fetched policy '%s' and will perform following actions:\n", policy.Name)
-
-			for n, tierID := range tierIDs {
-				for m := range tierAssignments[n] {
-					fmt.Printf(
-						"- create schedule '%s' with %d layer(s) for group '%s' for rule ID='%s', with following user(s):\n",
-						tierAssignments[n][m].SlotName,
-						len(tierAssignments[n][m].Assignments),
-						tierAssignments[n][m].Group,
-						tierID,
-					)
-					for l := range tierAssignments[n][m].Assignments {
-						fmt.Printf(
-							"\t- layer '%s'\tstarting at %s@UTC: \t%s\n",
-							daysOfWeek[tierAssignments[n][m].Assignments[l].DayOfWeek],
-							tierAssignments[n][m].Assignments[l].StartUtc,
-							tierAssignments[n][m].Assignments[l].User,
-						)
-					}
-				}
-				fmt.Printf("- this will result in total %d schedule(s) per rule ID='%s'\n", len(tierAssignments[n]), tierID)
-			}
+	existingSchedules, err := findAutoSchedules(ctx, slotPrefix)
+	if err != nil {
+		return err
+	}
 
-			for n := range oldSchedules {
-				fmt.Printf("- attempt to unassign and delete old schedule: %s (ID: '%s')\n", oldSchedules[n].Name, oldSchedules[n].ID)
+	// match existing schedules to groups, duplicates are treated as stale
+	byGroup := make(map[string]*pagerduty.Schedule)
+	for n := range existingSchedules {
+		group := generatedSlotSuffix.ReplaceAllString(strings.TrimPrefix(existingSchedules[n].Name, slotPrefix), "")
+		if _, ok := byGroup[group]; !ok {
+			byGroup[group] = &existingSchedules[n]
+		}
+	}
+
+	changes := make([][]*pagerDutySlotChange, len(tierIDs))
+	used := make(map[string]bool)
+	for n := range tierIDs {
+		for _, tier := range plan.tierAssignments[n] {
+			change := &pagerDutySlotChange{tier: tier}
+			existing, ok := byGroup[tier.Group]
+			if ok {
+				tier.SlotName = existing.Name
+				change.existing = existing
+				used[existing.ID] = true
+			} else {
+				tier.SlotName = fmt.Sprintf("%s%s_%s", slotPrefix, tier.Group, deterministicSlotSuffix(plan.placement.seed, slotPrefix+tier.Group))
 			}
+			change.schedule = slotSchedule(ctx, tier.SlotName, tier.Assignments, plan.startDate, plan.endDate)
+			change.create = !ok
+			change.update = ok && !sameLayers(existing.ScheduleLayers, change.schedule.ScheduleLayers)
+			changes[n] = append(changes[n], change)
+		}
+	}
 
-			if ctx.Verbose {
-				fmt.Printf("Proceed? [y/N] ")
+	oldSchedules := make([]pagerduty.Schedule, 0)
+	for _, schedule := range existingSchedules {
+		if !used[schedule.ID] {
+			oldSchedules = append(oldSchedules, schedule)
+		}
+	}
 
-				reader := bufio.NewReader(os.Stdin)
-				input, err := reader.ReadString('\n')
-				if err != nil || len(input) < 1 || input[0] != 'y' {
-					fmt.Println("Aborting.")
-					continue
-				}
+	// desired policy, targets of existing schedules are known already
+	desiredPolicy := *policy
+	desiredPolicy.EscalationRules = make([]pagerduty.EscalationRule, len(policy.EscalationRules))
+	copy(desiredPolicy.EscalationRules, policy.EscalationRules)
+	for _, schedule := range oldSchedules {
+		deleteScheduleFromPolicy(&desiredPolicy, schedule.ID)
+	}
+	for n, tierID := range tierIDs {
+		err = fillTier(&desiredPolicy, tierID, changes[n])
+		if err != nil {
+			return err
+		}
+	}
+	policyChanged := false
+	for n := range policy.EscalationRules {
+		if !sameTargets(policy.EscalationRules[n].Targets, desiredPolicy.EscalationRules[n].Targets) {
+			policyChanged = true
+		}
+	}
+
+	logInfo(ctx, plan.cfg.GroupName, "Fetched policy '%s' and will perform following actions:", policy.Name)
+
+	changesCount := 0
+	for n, tierID := range tierIDs {
+		for _, change := range changes[n] {
+			action := ""
+			if change.create {
+				action = "create"
+			} else if change.update {
+				action = "update"
+			} else {
+				logInfo(ctx, plan.cfg.GroupName, "- keep schedule '%s' for group '%s' for rule ID='%s'", change.tier.SlotName, change.tier.Group, tierID)
+				continue
 			}
+			changesCount++
+			logInfo(ctx, plan.cfg.GroupName,
+				"- %s schedule '%s' with %d layer(s) for group '%s' for rule ID='%s', with following user(s):",
+				action,
+				change.tier.SlotName,
+				len(change.tier.Assignments),
+				change.tier.Group,
+				tierID,
+			)
+			logPagerDutySlotLayers(ctx, plan.cfg.GroupName, change.tier.Assignments)
+		}
+		logInfo(ctx, plan.cfg.GroupName, "- this will result in total %d schedule(s) per rule ID='%s'", len(changes[n]), tierID)
+	}
 
-			fmt.Println("Proceeding")
+	if policyChanged {
+		changesCount++
+		logInfo(ctx, plan.cfg.GroupName, "- update policy '%s' targets", policy.Name)
+	}
 
-			// execution phase
+	for n := range oldSchedules {
+		changesCount++
+		logInfo(ctx, plan.cfg.GroupName, "- attempt to unassign and delete old schedule: %s (ID: '%s')", oldSchedules[n].Name, oldSchedules[n].ID)
+	}
 
-			// create new schedules
-			for n, tierID := range tierIDs {
-				err = fillTier(ctx, policy, tierID, tierAssignments[n], startDate, endDate)
-				if err != nil {
-					return err
-				}
-			}
+	if changesCount == 0 {
+		logInfo(ctx, plan.cfg.GroupName, "No changes")
+		return nil
+	}
 
-			// update policy
-			_, err = ctx.pagerduty.UpdateEscalationPolicy(policyID, policy)
-			if err != nil {
-				return errors.Wrap(err, 0)
-			}
+	if !confirmChanges(ctx) {
+		return errPagerDutyAborted
+	}
+
+	// execution phase
+	journal := newPagerDutyJournal(ctx)
+	previousPolicy := copyPolicy(policy)
 
-			// remove old schedules
-			for n := range oldSchedules {
-				ctx.pagerduty.DeleteSchedule(oldSchedules[n].ID)
+	// create and update schedules
+	for n, tierID := range tierIDs {
+		for _, change := range changes[n] {
+			if change.create {
+				saved, err := journal.createSchedule(change.schedule)
+				if err != nil {
+					return journal.rollback(err)
+				}
+				change.existing = saved
+				policyChanged = true
+			} else if change.update {
+				err := journal.updateSchedule(change.existing, reuseLayers(change.existing, change.schedule))
+				if err != nil {
+					return journal.rollback(err)
+				}
 			}
+		}
+		err = fillTier(policy, tierID, changes[n])
+		if err != nil {
+			return journal.rollback(err)
+		}
+	}
 
-			fmt.Println("Policy updated")
+	// update policy
+	for _, schedule := range oldSchedules {
+		deleteScheduleFromPolicy(policy, schedule.ID)
+	}
+	if policyChanged {
+		err = journal.updatePolicy(previousPolicy, policy)
+		if err != nil {
+			return journal.rollback(err)
 		}
 	}
 
+	// remove old schedules
+	err = deleteSchedules(ctx, oldSchedules)
+	if err != nil {
+		return err
+	}
+
+	logInfo(ctx, plan.cfg.GroupName, "Policy updated")
 	return nil
 }
 
-func clearAutoSchedules(ctx *RuntimeContext, policy *pagerduty.EscalationPolicy, prefix string) ([]pagerduty.Schedule, error) {
-	var listOpts pagerduty.ListSchedulesOptions
-	listOpts.Query = fmt.Sprintf("Slot_%s_%s", policy.Name, prefix)
-	scheds, err := ctx.pagerduty.ListSchedules(listOpts)
-
+// findAutoSchedules returns schedules created in schedules mode along with their layers
+func findAutoSchedules(ctx *RuntimeContext, slotPrefix string) ([]pagerduty.Schedule, error) {
+	found, err := findSchedulesByPrefix(ctx, slotPrefix)
 	if err != nil {
 		return nil, err
 	}
-
-	for n := range scheds.Schedules {
-		deleteScheduleFromPolicy(policy, scheds.Schedules[n].ID)
+	schedules := make([]pagerduty.Schedule, 0, len(found))
+	for _, schedule := range found {
+		if !generatedSlotSuffix.MatchString(schedule.Name) {
+			continue
+		}
+		details, err := ctx.pagerduty.GetSchedule(schedule.ID, pagerduty.GetScheduleOptions{TimeZone: "UTC"})
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		schedules = append(schedules, *details)
 	}
-
-	return scheds.Schedules, nil
+	return schedules, nil
 }
 
 func deleteScheduleFromPolicy(policy *pagerduty.EscalationPolicy, scheduleID string) {
@@ -402,13 +571,11 @@ func deleteScheduleFromPolicy(policy *pagerduty.EscalationPolicy, scheduleID str
 	}
 }
 
+// fillTier points rule to slot schedules, schedules yet to be created are skipped
 func fillTier(
-	ctx *RuntimeContext,
 	policy *pagerduty.EscalationPolicy,
 	ruleID string,
-	assignments []*PagerDutyTierAssignment,
-	startDate time.Time,
-	endDate time.Time,
+	changes []*pagerDutySlotChange,
 ) error {
 	var ruleNo = -1
 	for n, rule := range policy.EscalationRules {
@@ -421,33 +588,92 @@ func fillTier(
 		return errors.Errorf("No rule id='%s'", ruleID)
 	}
 
-	policy.EscalationRules[ruleNo].Targets = make([]pagerduty.APIObject, len(assignments))
-	for n, a := range assignments {
-		schedule, err := createSlot(
-			ctx,
-			a.SlotName,
-			a.Assignments,
-			startDate,
-			endDate,
-		)
-		if err != nil {
-			return err
+	targets := make([]pagerduty.APIObject, 0, len(changes))
+	for _, change := range changes {
+		if change.existing == nil {
+			continue
 		}
-		policy.EscalationRules[ruleNo].Targets[n] = pagerduty.APIObject{
-			ID:   schedule.ID,
+		targets = append(targets, pagerduty.APIObject{
+			ID:   change.existing.ID,
 			Type: "schedule_reference",
-		}
+		})
 	}
+	policy.EscalationRules[ruleNo].Targets = targets
 	return nil
 }
 
-func createSlot(
+// reuseLayers keeps IDs of existing layers so they are updated in place,
+// superfluous existing layers are ended at their start
+func reuseLayers(existing *pagerduty.Schedule, schedule pagerduty.Schedule) pagerduty.Schedule {
+	layers := make([]pagerduty.ScheduleLayer, len(schedule.ScheduleLayers))
+	copy(layers, schedule.ScheduleLayers)
+	for n, layer := range existing.ScheduleLayers {
+		if n < len(layers) {
+			layers[n].ID = layer.ID
+			continue
+		}
+		layer.End = layer.Start
+		layers = append(layers, layer)
+	}
+	schedule.ScheduleLayers = layers
+	return schedule
+}
+
+func layerKey(layer pagerduty.ScheduleLayer) string {
+	var b strings.Builder
+	start, _ := time.Parse(time.RFC3339, layer.Start)
+	end, _ := time.Parse(time.RFC3339, layer.End)
+	fmt.Fprintf(&b, "%d|%d|%d", start.Unix(), end.Unix(), layer.RotationTurnLengthSeconds)
+	for _, user := range layer.Users {
+		fmt.Fprintf(&b, "|%s", user.User.ID)
+	}
+	for _, restriction := range layer.Restrictions {
+		fmt.Fprintf(&b, "|%s@%d+%d", restriction.StartTimeOfDay, restriction.StartDayOfWeek, restriction.DurationSeconds)
+	}
+	return b.String()
+}
+
+// activeLayers skips zero-length layers (placeholders and layers ended by reuseLayers)
+func activeLayers(layers []pagerduty.ScheduleLayer) []pagerduty.ScheduleLayer {
+	active := make([]pagerduty.ScheduleLayer, 0, len(layers))
+	for _, layer := range layers {
+		start, _ := time.Parse(time.RFC3339, layer.Start)
+		end, _ := time.Parse(time.RFC3339, layer.End)
+		if layer.End != "" && !end.After(start) {
+			continue
+		}
+		active = append(active, layer)
+	}
+	return active
+}
+
+func sameLayers(a, b []pagerduty.ScheduleLayer) bool {
+	a = activeLayers(a)
+	b = activeLayers(b)
+	if len(a) != len(b) {
+		return false
+	}
+	keys := make(map[string]int)
+	for _, layer := range a {
+		keys[layerKey(layer)]++
+	}
+	for _, layer := range b {
+		key := layerKey(layer)
+		if keys[key] == 0 {
+			return false
+		}
+		keys[key]--
+	}
+	return true
+}
+
+func slotSchedule(
 	ctx *RuntimeContext,
 	slotName string,
 	assignments []*PagerDutySlotAssignment,
 	startDate time.Time,
 	endDate time.Time,
-) (*pagerduty.Schedule, error) {
+) pagerduty.Schedule {
 	var schedule pagerduty.Schedule
 	schedule.Name = slotName
 	schedule.TimeZone = "UTC"
@@ -455,9 +681,14 @@ func createSlot(
 	schedule.ScheduleLayers = make([]pagerduty.ScheduleLayer, len(assignments))
 
 	for n, a := range assignments {
-		schedule.ScheduleLayers[n].Name = daysOfWeek[a.DayOfWeek]
+		// shifts crossing end of range (eg. weekend shifts) are not cut
+		end := endDate
+		if shiftEnd := a.Start.Add(slotDuration(a)); shiftEnd.After(end) {
+			end = shiftEnd
+		}
+		schedule.ScheduleLayers[n].Name = daysOfWeek[a.DayOfWeek%7]
 		schedule.ScheduleLayers[n].Start = startDate.Format(time.RFC3339)
-		schedule.ScheduleLayers[n].End = endDate.Format(time.RFC3339)
+		schedule.ScheduleLayers[n].End = end.Format(time.RFC3339)
 		schedule.ScheduleLayers[n].RotationVirtualStart = startDate.Format(time.RFC3339)
 		schedule.ScheduleLayers[n].RotationTurnLengthSeconds = 24 * 60 * 60
 		schedule.ScheduleLayers[n].Users = make([]pagerduty.UserReference, 1)
@@ -468,7 +699,7 @@ func createSlot(
 		schedule.ScheduleLayers[n].Restrictions = make([]pagerduty.Restriction, 1)
 		schedule.ScheduleLayers[n].Restrictions[0].Type = "weekly_restriction"
 		schedule.ScheduleLayers[n].Restrictions[0].StartTimeOfDay = a.StartUtc
-		schedule.ScheduleLayers[n].Restrictions[0].DurationSeconds = 8 * 60 * 60
+		schedule.ScheduleLayers[n].Restrictions[0].DurationSeconds = uint(slotDuration(a).Seconds())
 		schedule.ScheduleLayers[n].Restrictions[0].StartDayOfWeek = a.DayOfWeek
 	}
 
@@ -489,11 +720,5 @@ func createSlot(
 		schedule.Description = "Automatic schedule generator slot (in use)"
 	}
 
-	savedSchedule, err := ctx.pagerduty.CreateSchedule(schedule)
-
-	if err != nil {
-		return nil, errors.Wrap(err, 0)
-	}
-
-	return savedSchedule, err
+	return schedule
 }
@@ -0,0 +1,174 @@
+package src
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/go-errors/errors"
+)
+
+const (
+	pagerDutyDirectoryFile       = "pagerduty_directory"
+	defaultPagerDutyDirectoryTTL = 24 * time.Hour
+	pagerDutyPageLimit           = 100
+)
+
+// pagerDutyDirectory - PagerDuty users cached between runs, big accounts take many pages to list
+type pagerDutyDirectory struct {
+	FetchedAt time.Time  `json:"fetchedAt"`
+	TeamIDs   []string   `json:"teamIDs"`
+	Users     PDUserList `json:"users"`
+}
+
+// directoryTeamIDs returns teams to list users of, nil (everybody) when any policy has no teams
+func directoryTeamIDs(ctx *RuntimeContext) []string {
+	teams := make([]string, 0)
+	for _, cfg := range ctx.Configs {
+		for _, pd := range cfg.PagerDuty {
+			if len(pd.Teams) == 0 {
+				return nil
+			}
+			for _, team := range pd.Teams {
+				if !contains(teams, team) {
+					teams = append(teams, team)
+				}
+			}
+		}
+	}
+	if len(teams) == 0 {
+		return nil
+	}
+	sort.Strings(teams)
+	return teams
+}
+
+func pagerDutyDirectoryTTL(ctx *RuntimeContext) (time.Duration, error) {
+	if ctx.PagerDutyDirectoryTTL == "" {
+		return defaultPagerDutyDirectoryTTL, nil
+	}
+	ttl, err := time.ParseDuration(ctx.PagerDutyDirectoryTTL)
+	if err != nil {
+		return 0, errors.Errorf("Invalid pagerDutyDirectoryTTL '%s'", ctx.PagerDutyDirectoryTTL)
+	}
+	return ttl, nil
+}
+
+// loadPagerDutyDirectory returns cached users when fresh enough, lists them otherwise
+func loadPagerDutyDirectory(ctx *RuntimeContext) (PDUserList, error) {
+	ttl, err := pagerDutyDirectoryTTL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	teamIDs := directoryTeamIDs(ctx)
+
+	if ttl > 0 {
+		data, err := loadState(ctx, pagerDutyDirectoryFile)
+		if err == nil {
+			var cached pagerDutyDirectory
+			err = json.Unmarshal(data, &cached)
+			if err == nil &&
+				strings.Join(cached.TeamIDs, ",") == strings.Join(teamIDs, ",") &&
+				time.Since(cached.FetchedAt) < ttl {
+				return cached.Users, nil
+			}
+		}
+	}
+
+	users, err := listPagerDutyUsers(ctx, teamIDs)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		data, err := json.Marshal(pagerDutyDirectory{FetchedAt: time.Now(), TeamIDs: teamIDs, Users: users})
+		if err == nil {
+			err = saveState(ctx, pagerDutyDirectoryFile, data)
+		}
+		if err != nil && err != errNoStateStorage {
+			logError(ctx, "", err, "Unable to cache PagerDuty directory")
+		}
+	}
+	return users, nil
+}
+
+func listPagerDutyUsers(ctx *RuntimeContext, teamIDs []string) (PDUserList, error) {
+	users := make(PDUserList, 0)
+	opts := pagerduty.ListUsersOptions{Limit: pagerDutyPageLimit, TeamIDs: teamIDs}
+	for {
+		response, err := ctx.pagerduty.ListUsers(opts)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		users = append(users, response.Users...)
+		if !response.More || len(response.Users) == 0 {
+			break
+		}
+		opts.Offset += uint(len(response.Users))
+	}
+	return users, nil
+}
+
+func listPagerDutySchedules(ctx *RuntimeContext, query string) ([]pagerduty.Schedule, error) {
+	schedules := make([]pagerduty.Schedule, 0)
+	opts := pagerduty.ListSchedulesOptions{Limit: pagerDutyPageLimit, Query: query}
+	for {
+		response, err := ctx.pagerduty.ListSchedules(opts)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		schedules = append(schedules, response.Schedules...)
+		if !response.More || len(response.Schedules) == 0 {
+			break
+		}
+		opts.Offset += uint(len(response.Schedules))
+	}
+	return schedules, nil
+}
+
+func listPagerDutyPolicies(ctx *RuntimeContext) ([]pagerduty.EscalationPolicy, error) {
+	policies := make([]pagerduty.EscalationPolicy, 0)
+	opts := pagerduty.ListEscalationPoliciesOptions{Limit: pagerDutyPageLimit}
+	for {
+		response, err := ctx.pagerduty.ListEscalationPolicies(opts)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		policies = append(policies, response.EscalationPolicies...)
+		if !response.More || len(response.EscalationPolicies) == 0 {
+			break
+		}
+		opts.Offset += uint(len(response.EscalationPolicies))
+	}
+	return policies, nil
+}
+
+// configTeams returns teams of all policies of config, nil when any of them is not limited to teams
+func configTeams(cfg *AssignmentsConfig) []string {
+	teams := make([]string, 0)
+	for _, pd := range cfg.PagerDuty {
+		if len(pd.Teams) == 0 {
+			return nil
+		}
+		teams = append(teams, pd.Teams...)
+	}
+	return teams
+}
+
+// pdUsersInTeams returns users belonging to any of teams, all users when teams are not given
+func pdUsersInTeams(ctx *RuntimeContext, teams []string) PDUserList {
+	if len(teams) == 0 {
+		return ctx.pdUsers
+	}
+	users := make(PDUserList, 0)
+	for _, user := range ctx.pdUsers {
+		for _, team := range user.Teams {
+			if contains(teams, team.ID) {
+				users = append(users, user)
+				break
+			}
+		}
+	}
+	return users
+}
@@ -0,0 +1,148 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// distribution strategies of slot schedules across escalation rules (tiers)
+const (
+	pagerDutyDistributionFillInOrder     = "fillInOrder"
+	pagerDutyDistributionOneGroupPerTier = "oneGroupPerTier"
+	pagerDutyDistributionSpreadEvenly    = "spreadEvenly"
+)
+
+const defaultPagerDutyTargetsPerTier = 5
+
+func pagerDutyDistribution(pd *PagerDutyConfig) string {
+	if pd.Distribution == "" {
+		return pagerDutyDistributionFillInOrder
+	}
+	return pd.Distribution
+}
+
+// pagerDutyTargetsPerTier returns maximum number of slot schedules per rule
+func pagerDutyTargetsPerTier(pd *PagerDutyConfig) int {
+	if pagerDutyDistribution(pd) == pagerDutyDistributionOneGroupPerTier {
+		return 1
+	}
+	if pd.TargetsPerTier > 0 {
+		return pd.TargetsPerTier
+	}
+	return defaultPagerDutyTargetsPerTier
+}
+
+// distributePagerDutyTiers assigns groups (in order) to tiers, every tier gets at least one group
+func distributePagerDutyTiers(
+	pd *PagerDutyConfig,
+	groups []string,
+	assignments map[string]*PagerDutyTierAssignment,
+) ([][]*PagerDutyTierAssignment, error) {
+	tiersCount := len(pd.TierIDs)
+	limit := pagerDutyTargetsPerTier(pd)
+	if tiersCount == 0 {
+		return nil, errors.Errorf("No tiers configured for policy id='%s'", pd.PolicyID)
+	}
+	if len(groups) > tiersCount*limit {
+		return nil, errors.Errorf(
+			"Policy id='%s' needs %d slot schedules but %d tiers allow only %d (%d per tier, distribution '%s'), %d tiers is required",
+			pd.PolicyID,
+			len(groups),
+			tiersCount,
+			tiersCount*limit,
+			limit,
+			pagerDutyDistribution(pd),
+			(len(groups)+limit-1)/limit,
+		)
+	}
+
+	var order [][]string
+	switch pagerDutyDistribution(pd) {
+	case pagerDutyDistributionFillInOrder:
+		order = fillInOrderGroups(groups, tiersCount, limit)
+	case pagerDutyDistributionOneGroupPerTier, pagerDutyDistributionSpreadEvenly:
+		// consecutive groups, sizes differ by one at most
+		order = make([][]string, tiersCount)
+		next := 0
+		for n := range order {
+			size := len(groups) / tiersCount
+			if n < len(groups)%tiersCount {
+				size++
+			}
+			order[n] = groups[next : next+size]
+			next += size
+		}
+	default:
+		return nil, errors.Errorf("Unknown distribution '%s' for policy id='%s'", pd.Distribution, pd.PolicyID)
+	}
+
+	tierAssignments := make([][]*PagerDutyTierAssignment, tiersCount)
+	for n := range order {
+		if len(order[n]) == 0 {
+			return nil, errors.Errorf("Unable to distribute assignments for policy id='%s'", pd.PolicyID)
+		}
+		for _, group := range order[n] {
+			tierAssignments[n] = append(tierAssignments[n], assignments[group])
+		}
+	}
+	return tierAssignments, nil
+}
+
+// fillInOrderGroups fills tiers up to the limit first and then moves last group of
+// the fullest tier to every empty one
+func fillInOrderGroups(groups []string, tiersCount int, limit int) [][]string {
+	order := make([][]string, tiersCount)
+	next := 0
+	for n := range order {
+		for i := 0; i < limit && next < len(groups); i++ {
+			order[n] = append(order[n], groups[next])
+			next++
+		}
+	}
+	for n := range order {
+		if len(order[n]) != 0 {
+			continue
+		}
+		fullest := 0
+		for m := range order {
+			if len(order[m]) > len(order[fullest]) {
+				fullest = m
+			}
+		}
+		if len(order[fullest]) < 2 {
+			continue
+		}
+		last := len(order[fullest]) - 1
+		order[n] = append(order[n], order[fullest][last])
+		order[fullest] = order[fullest][:last]
+	}
+	return order
+}
+
+// logPagerDutyLayout explains which groups ended up in which tier and why
+func logPagerDutyLayout(ctx *RuntimeContext, plan *pagerDutyPlan) {
+	logInfo(ctx, plan.cfg.GroupName,
+		"Layout: distribution '%s', up to %d schedule(s) per rule, %d slot(s) for %d tier(s):",
+		pagerDutyDistribution(plan.pd),
+		pagerDutyTargetsPerTier(plan.pd),
+		len(plan.groups),
+		len(plan.pd.TierIDs),
+	)
+	for n, tierID := range plan.pd.TierIDs {
+		names := make([]string, 0, len(plan.tierAssignments[n]))
+		for _, tier := range plan.tierAssignments[n] {
+			names = append(names, fmt.Sprintf("%s (%d day(s))", tier.Group, len(tier.Assignments)))
+		}
+		logInfo(ctx, plan.cfg.GroupName, "- tier %d, rule ID='%s': %s", n+1, tierID, strings.Join(names, ", "))
+	}
+	switch pagerDutyDistribution(plan.pd) {
+	case pagerDutyDistributionFillInOrder:
+		logInfo(ctx, plan.cfg.GroupName, "  groups fill rules in order, rules left empty take last group of the fullest rule")
+	case pagerDutyDistributionOneGroupPerTier:
+		logInfo(ctx, plan.cfg.GroupName, "  every group (and backup slot) gets its own rule")
+	case pagerDutyDistributionSpreadEvenly:
+		logInfo(ctx, plan.cfg.GroupName, "  groups are spread in order so rule sizes differ by one at most")
+	}
+}
@@ -0,0 +1,217 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/go-errors/errors"
+)
+
+type pagerDutyJournalEntry struct {
+	description string
+	undo        func() error
+}
+
+// pagerDutyJournal records every PagerDuty mutation along with the way to undo it,
+// so partially applied changes can be rolled back when a later step fails
+type pagerDutyJournal struct {
+	ctx     *RuntimeContext
+	entries []pagerDutyJournalEntry
+}
+
+func newPagerDutyJournal(ctx *RuntimeContext) *pagerDutyJournal {
+	return &pagerDutyJournal{ctx: ctx}
+}
+
+func (j *pagerDutyJournal) record(description string, undo func() error) {
+	j.entries = append(j.entries, pagerDutyJournalEntry{description: description, undo: undo})
+}
+
+func (j *pagerDutyJournal) createSchedule(schedule pagerduty.Schedule) (*pagerduty.Schedule, error) {
+	saved, err := j.ctx.pagerduty.CreateSchedule(schedule)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	j.record(fmt.Sprintf("create schedule '%s' (ID: '%s')", saved.Name, saved.ID), func() error {
+		return j.ctx.pagerduty.DeleteSchedule(saved.ID)
+	})
+	return saved, nil
+}
+
+func (j *pagerDutyJournal) updateSchedule(previous *pagerduty.Schedule, schedule pagerduty.Schedule) error {
+	_, err := j.ctx.pagerduty.UpdateSchedule(previous.ID, schedule)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	j.record(fmt.Sprintf("update schedule '%s' (ID: '%s')", previous.Name, previous.ID), func() error {
+		_, err := j.ctx.pagerduty.UpdateSchedule(previous.ID, *previous)
+		return err
+	})
+	return nil
+}
+
+func (j *pagerDutyJournal) updatePolicy(previous *pagerduty.EscalationPolicy, policy *pagerduty.EscalationPolicy) error {
+	_, err := j.ctx.pagerduty.UpdateEscalationPolicy(previous.ID, policy)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	j.record(fmt.Sprintf("update policy '%s' (ID: '%s')", previous.Name, previous.ID), func() error {
+		_, err := j.ctx.pagerduty.UpdateEscalationPolicy(previous.ID, previous)
+		return err
+	})
+	return nil
+}
+
+func (j *pagerDutyJournal) createOverride(scheduleID string, override pagerduty.Override) error {
+	saved, err := j.ctx.pagerduty.CreateOverride(scheduleID, override)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	j.record(fmt.Sprintf("create override %s - %s in schedule ID='%s'", saved.Start, saved.End, scheduleID), func() error {
+		return j.ctx.pagerduty.DeleteOverride(scheduleID, saved.ID)
+	})
+	return nil
+}
+
+func (j *pagerDutyJournal) deleteOverride(scheduleID string, override pagerduty.Override) error {
+	err := j.ctx.pagerduty.DeleteOverride(scheduleID, override.ID)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	j.record(fmt.Sprintf("delete override %s - %s in schedule ID='%s'", override.Start, override.End, scheduleID), func() error {
+		_, err := j.ctx.pagerduty.CreateOverride(scheduleID, pagerduty.Override{
+			Start: override.Start,
+			End:   override.End,
+			User:  pagerduty.APIObject{ID: override.User.ID, Type: "user_reference"},
+		})
+		return err
+	})
+	return nil
+}
+
+// rollback undoes recorded mutations in reverse order and returns original
+// error annotated with rollback failures (if any)
+func (j *pagerDutyJournal) rollback(cause error) error {
+	logWarn(j.ctx, "", "Error occurred, rolling back %d change(s)", len(j.entries))
+	failures := make([]string, 0)
+	for n := len(j.entries) - 1; n >= 0; n-- {
+		entry := j.entries[n]
+		err := entry.undo()
+		if err != nil {
+			logError(j.ctx, "", err, "Unable to undo %s", entry.description)
+			failures = append(failures, entry.description)
+			continue
+		}
+		logInfo(j.ctx, "", "Undone %s", entry.description)
+	}
+	j.entries = nil
+	if len(failures) > 0 {
+		return errors.Errorf("%v (rollback failed for: %s)", cause, strings.Join(failures, ", "))
+	}
+	return cause
+}
+
+// deleteSchedules removes unused schedules once all other changes succeeded, it cannot
+// be undone so failures are reported only (leftovers are removed by pagerDutyCleanup)
+func deleteSchedules(ctx *RuntimeContext, schedules []pagerduty.Schedule) error {
+	failures := make([]string, 0)
+	for _, schedule := range schedules {
+		err := ctx.pagerduty.DeleteSchedule(schedule.ID)
+		if err != nil {
+			logError(ctx, "", err, "Unable to delete schedule %s", schedule.Name)
+			failures = append(failures, schedule.ID)
+		}
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("Unable to delete schedule(s) %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+func copyPolicy(policy *pagerduty.EscalationPolicy) *pagerduty.EscalationPolicy {
+	copied := *policy
+	copied.EscalationRules = make([]pagerduty.EscalationRule, len(policy.EscalationRules))
+	for n, rule := range policy.EscalationRules {
+		copied.EscalationRules[n] = rule
+		copied.EscalationRules[n].Targets = make([]pagerduty.APIObject, len(rule.Targets))
+		copy(copied.EscalationRules[n].Targets, rule.Targets)
+	}
+	return &copied
+}
+
+// PagerDutyCleanup - removes generated Slot_ schedules of configured policies not referenced by any escalation policy
+func PagerDutyCleanup(ctx *RuntimeContext) {
+	err := pagerDutyCleanup(ctx)
+	if err != nil {
+		logError(ctx, "", err, "Unable to clean up PagerDuty schedules")
+	}
+}
+
+func pagerDutyCleanup(ctx *RuntimeContext) error {
+	policies, err := listPagerDutyPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	referenced := make(map[string]bool)
+	for _, policy := range policies {
+		for _, rule := range policy.EscalationRules {
+			for _, target := range rule.Targets {
+				if target.Type == "schedule_reference" || target.Type == "schedule" {
+					referenced[target.ID] = true
+				}
+			}
+		}
+	}
+
+	// only schedules generated for configured policies are candidates, schedules created by hand and
+	// long-lived ones of overrides mode (no random suffix, kept on purpose for unused groups) are left alone
+	orphaned := make([]pagerduty.Schedule, 0)
+	seen := make(map[string]bool)
+	for _, cfg := range ctx.Configs {
+		for _, pd := range cfg.PagerDuty {
+			policy := findPagerDutyPolicy(policies, pd.PolicyID)
+			if policy == nil {
+				logWarn(ctx, cfg.GroupName, "Policy ID='%s' not found, its schedules are not cleaned up", pd.PolicyID)
+				continue
+			}
+			schedules, err := findSchedulesByPrefix(ctx, fmt.Sprintf("Slot_%s_%s", policy.Name, pd.Prefix))
+			if err != nil {
+				return err
+			}
+			for _, schedule := range schedules {
+				if seen[schedule.ID] || referenced[schedule.ID] || !generatedSlotSuffix.MatchString(schedule.Name) {
+					continue
+				}
+				seen[schedule.ID] = true
+				orphaned = append(orphaned, schedule)
+			}
+		}
+	}
+
+	if len(orphaned) == 0 {
+		logInfo(ctx, "", "No orphaned schedules")
+		return nil
+	}
+	for _, schedule := range orphaned {
+		logInfo(ctx, "", "- delete orphaned schedule: %s (ID: '%s')", schedule.Name, schedule.ID)
+	}
+	if !confirmChanges(ctx) {
+		return nil
+	}
+	err = deleteSchedules(ctx, orphaned)
+	if err != nil {
+		return err
+	}
+	logInfo(ctx, "", "Orphaned schedules removed")
+	return nil
+}
+
+func findPagerDutyPolicy(policies []pagerduty.EscalationPolicy, id string) *pagerduty.EscalationPolicy {
+	for n := range policies {
+		if policies[n].ID == id {
+			return &policies[n]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package src
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/go-errors/errors"
+)
+
+// UsesPagerDutyOnCall - true when any group takes its people from PagerDuty on-call
+func UsesPagerDutyOnCall(ctx *RuntimeContext) bool {
+	for _, cfg := range ctx.Configs {
+		if cfg.PagerDutyOnCall != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// getOnCallNames returns people on call at given time, roles are schedule names (or escalation levels)
+func getOnCallNames(ctx *RuntimeContext, cfg *AssignmentsConfig, date time.Time) ([]NameGroup, error) {
+	onCall := cfg.PagerDutyOnCall
+	if ctx.pagerduty == nil {
+		return nil, errors.Errorf("PagerDuty is not loaded for on-call group '%s'", cfg.GroupName)
+	}
+	opts := pagerduty.ListOnCallOptions{
+		Includes: []string{"users"},
+		Since:    date.Format(time.RFC3339),
+		Until:    date.Add(time.Minute).Format(time.RFC3339),
+	}
+	if len(onCall.ScheduleIDs) > 0 {
+		opts.ScheduleIDs = onCall.ScheduleIDs
+	}
+	if onCall.PolicyID != "" {
+		opts.EscalationPolicyIDs = []string{onCall.PolicyID}
+	}
+	onCalls, err := listOnCalls(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]NameGroup, 0, len(onCalls))
+	seen := make(map[string]bool)
+	for _, entry := range onCalls {
+		if len(onCall.EscalationLevels) > 0 && !containsLevel(onCall.EscalationLevels, entry.EscalationLevel) {
+			continue
+		}
+		if seen[entry.User.ID] {
+			continue
+		}
+		seen[entry.User.ID] = true
+
+		name := NameGroup{
+			Name:  entry.User.Name,
+			Group: entry.Schedule.Summary,
+			Email: entry.User.Email,
+			Tier:  entry.EscalationLevel,
+		}
+		if name.Group == "" {
+			name.Group = fmt.Sprintf("L%d", entry.EscalationLevel)
+		}
+		if name.Name == "" || name.Email == "" {
+			for _, user := range ctx.pdUsers {
+				if user.ID == entry.User.ID {
+					name.Name = user.Name
+					name.Email = user.Email
+				}
+			}
+		}
+		if name.Name == "" {
+			name.Name = entry.User.Summary
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// getOnCallAssignmentDay - previous and next are on-call a day before and after, so
+// handoff is sent only when on-call actually changes
+func getOnCallAssignmentDay(ctx *RuntimeContext, cfg *AssignmentsConfig, date time.Time) (*assignmentDay, error) {
+	day := &assignmentDay{Date: date}
+	var err error
+	day.Current, err = getOnCallNames(ctx, cfg, date)
+	if err != nil {
+		return nil, err
+	}
+	day.Previous, err = getOnCallNames(ctx, cfg, date.AddDate(0, 0, -1))
+	if err != nil {
+		return nil, err
+	}
+	day.Next, err = getOnCallNames(ctx, cfg, date.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	return day, nil
+}
@@ -0,0 +1,300 @@
+package src
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/go-errors/errors"
+)
+
+const (
+	// pagerDutyModeSchedules - schedules are recreated on every run (default)
+	pagerDutyModeSchedules = "schedules"
+	// pagerDutyModeOverrides - one long-lived schedule per tier, assignments applied as overrides
+	pagerDutyModeOverrides = "overrides"
+)
+
+// pagerDutyShiftDuration - default shift duration, see dutyShift
+const pagerDutyShiftDuration = 8 * time.Hour
+
+// generated schedule names (schedules mode) end with random suffix
+var generatedSlotSuffix = regexp.MustCompile(`_[0-9A-F]{6}$`)
+
+type pagerDutyOverrideChange struct {
+	scheduleID   string
+	scheduleName string
+	create       []pagerduty.Override
+	remove       []pagerduty.Override
+}
+
+func longLivedSlotName(policy *pagerduty.EscalationPolicy, prefix, group string) string {
+	return fmt.Sprintf("Slot_%s_%s%s", policy.Name, prefix, group)
+}
+
+func overrideKey(userID, start, end string) string {
+	startTime, _ := time.Parse(time.RFC3339, start)
+	endTime, _ := time.Parse(time.RFC3339, end)
+	return fmt.Sprintf("%s|%d|%d", userID, startTime.Unix(), endTime.Unix())
+}
+
+func overrideFor(a *PagerDutySlotAssignment) pagerduty.Override {
+	return pagerduty.Override{
+		Start: a.Start.Format(time.RFC3339),
+		End:   a.Start.Add(slotDuration(a)).Format(time.RFC3339),
+		User: pagerduty.APIObject{
+			ID:   strings.Split(a.User, "|")[0],
+			Type: "user_reference",
+		},
+	}
+}
+
+func findSchedulesByPrefix(ctx *RuntimeContext, prefix string) ([]pagerduty.Schedule, error) {
+	schedules, err := listPagerDutySchedules(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]pagerduty.Schedule, 0, len(schedules))
+	for _, schedule := range schedules {
+		if strings.HasPrefix(schedule.Name, prefix) {
+			found = append(found, schedule)
+		}
+	}
+	return found, nil
+}
+
+func planOverrideChanges(
+	ctx *RuntimeContext,
+	plan *pagerDutyPlan,
+	scheduleID string,
+	scheduleName string,
+	assignments []*PagerDutySlotAssignment,
+) (*pagerDutyOverrideChange, error) {
+	change := &pagerDutyOverrideChange{
+		scheduleID:   scheduleID,
+		scheduleName: scheduleName,
+	}
+
+	desired := make(map[string]pagerduty.Override)
+	for _, a := range assignments {
+		override := overrideFor(a)
+		desired[overrideKey(override.User.ID, override.Start, override.End)] = override
+	}
+
+	existing := make(map[string]bool)
+	if scheduleID != "" {
+		overrides, err := ctx.pagerduty.ListOverrides(scheduleID, pagerduty.ListOverridesOptions{
+			Since: plan.startDate.Format(time.RFC3339),
+			Until: plan.endDate.Format(time.RFC3339),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		for _, override := range overrides.Overrides {
+			start, err := time.Parse(time.RFC3339, override.Start)
+			// overrides reaching into range from previous one are left intact
+			if err != nil || start.Before(plan.startDate) || !start.Before(plan.endDate) {
+				continue
+			}
+			key := overrideKey(override.User.ID, override.Start, override.End)
+			if _, ok := desired[key]; ok {
+				existing[key] = true
+				continue
+			}
+			change.remove = append(change.remove, override)
+		}
+	}
+
+	for _, a := range assignments {
+		override := overrideFor(a)
+		if !existing[overrideKey(override.User.ID, override.Start, override.End)] {
+			change.create = append(change.create, override)
+		}
+	}
+	return change, nil
+}
+
+func applyPagerDutyOverrides(ctx *RuntimeContext, plan *pagerDutyPlan, policy *pagerduty.EscalationPolicy) error {
+	prefix := plan.pd.Prefix
+	tierIDs := plan.pd.TierIDs
+
+	autoSchedules, err := findSchedulesByPrefix(ctx, fmt.Sprintf("Slot_%s_%s", policy.Name, prefix))
+	if err != nil {
+		return err
+	}
+	schedulesByName := make(map[string]pagerduty.Schedule)
+	for _, schedule := range autoSchedules {
+		schedulesByName[schedule.Name] = schedule
+	}
+
+	// leftovers of schedules mode are removed, long-lived schedules of unused groups are kept
+	oldSchedules := make([]pagerduty.Schedule, 0)
+	for _, schedule := range autoSchedules {
+		if generatedSlotSuffix.MatchString(schedule.Name) {
+			oldSchedules = append(oldSchedules, schedule)
+		}
+	}
+
+	logInfo(ctx, plan.cfg.GroupName, "Fetched policy '%s' and will perform following actions:", policy.Name)
+
+	changes := make([]*pagerDutyOverrideChange, 0, len(plan.groups))
+	missing := make(map[string]bool)
+	for n, tierID := range tierIDs {
+		for _, tier := range plan.tierAssignments[n] {
+			tier.SlotName = longLivedSlotName(policy, prefix, tier.Group)
+			schedule, ok := schedulesByName[tier.SlotName]
+			if !ok {
+				missing[tier.SlotName] = true
+				logInfo(ctx, plan.cfg.GroupName, "- create long-lived schedule '%s' for group '%s' for rule ID='%s'", tier.SlotName, tier.Group, tierID)
+			}
+			change, err := planOverrideChanges(ctx, plan, schedule.ID, tier.SlotName, tier.Assignments)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change)
+			for _, override := range change.remove {
+				logInfo(ctx, plan.cfg.GroupName, "- remove override in '%s': %s - %s %s", tier.SlotName, override.Start, override.End, override.User.Summary)
+			}
+			for _, override := range change.create {
+				logInfo(ctx, plan.cfg.GroupName, "- add override in '%s': %s - %s %s", tier.SlotName, override.Start, override.End, override.User.ID)
+			}
+		}
+	}
+
+	for n := range oldSchedules {
+		logInfo(ctx, plan.cfg.GroupName, "- attempt to unassign and delete old schedule: %s (ID: '%s')", oldSchedules[n].Name, oldSchedules[n].ID)
+	}
+
+	if len(missing) == 0 && len(oldSchedules) == 0 && !overridesPolicyChanged(plan, policy, schedulesByName) {
+		changesCount := 0
+		for _, change := range changes {
+			changesCount += len(change.remove) + len(change.create)
+		}
+		if changesCount == 0 {
+			logInfo(ctx, plan.cfg.GroupName, "No changes")
+			return nil
+		}
+	}
+
+	if !confirmChanges(ctx) {
+		return errPagerDutyAborted
+	}
+
+	// execution phase
+	journal := newPagerDutyJournal(ctx)
+	previousPolicy := copyPolicy(policy)
+
+	// create missing long-lived schedules
+	for n := range tierIDs {
+		for _, tier := range plan.tierAssignments[n] {
+			if !missing[tier.SlotName] {
+				continue
+			}
+			schedule, err := journal.createSchedule(slotSchedule(ctx, tier.SlotName, nil, plan.startDate, plan.endDate))
+			if err != nil {
+				return journal.rollback(err)
+			}
+			schedulesByName[tier.SlotName] = *schedule
+		}
+	}
+
+	// point policy rules to long-lived schedules
+	for _, schedule := range oldSchedules {
+		deleteScheduleFromPolicy(policy, schedule.ID)
+	}
+	policyChanged := len(oldSchedules) > 0
+	for n, tierID := range tierIDs {
+		ruleNo := -1
+		for m, rule := range policy.EscalationRules {
+			if rule.ID == tierID {
+				ruleNo = m
+			}
+		}
+		if ruleNo == -1 {
+			return journal.rollback(errors.Errorf("No rule id='%s'", tierID))
+		}
+		targets := overrideTargets(plan, n, schedulesByName)
+		if !sameTargets(policy.EscalationRules[ruleNo].Targets, targets) {
+			policy.EscalationRules[ruleNo].Targets = targets
+			policyChanged = true
+		}
+	}
+	if policyChanged {
+		err = journal.updatePolicy(previousPolicy, policy)
+		if err != nil {
+			return journal.rollback(err)
+		}
+	}
+
+	// replace overrides
+	for _, change := range changes {
+		scheduleID := schedulesByName[change.scheduleName].ID
+		for _, override := range change.remove {
+			err = journal.deleteOverride(scheduleID, override)
+			if err != nil {
+				return journal.rollback(err)
+			}
+		}
+		for _, override := range change.create {
+			err = journal.createOverride(scheduleID, override)
+			if err != nil {
+				return journal.rollback(err)
+			}
+		}
+	}
+
+	// remove old schedules
+	err = deleteSchedules(ctx, oldSchedules)
+	if err != nil {
+		return err
+	}
+
+	logInfo(ctx, plan.cfg.GroupName, "Policy overrides updated")
+	return nil
+}
+
+// overrideTargets returns long-lived schedules of tier groups as targets of n-th rule
+func overrideTargets(plan *pagerDutyPlan, n int, schedulesByName map[string]pagerduty.Schedule) []pagerduty.APIObject {
+	targets := make([]pagerduty.APIObject, len(plan.tierAssignments[n]))
+	for m, tier := range plan.tierAssignments[n] {
+		targets[m] = pagerduty.APIObject{
+			ID:   schedulesByName[tier.SlotName].ID,
+			Type: "schedule_reference",
+		}
+	}
+	return targets
+}
+
+// overridesPolicyChanged tells whether policy rules do not point to existing long-lived schedules of the plan yet
+func overridesPolicyChanged(plan *pagerDutyPlan, policy *pagerduty.EscalationPolicy, schedulesByName map[string]pagerduty.Schedule) bool {
+	for n, tierID := range plan.pd.TierIDs {
+		targets := overrideTargets(plan, n, schedulesByName)
+		found := false
+		for _, rule := range policy.EscalationRules {
+			if rule.ID == tierID {
+				found = true
+				if !sameTargets(rule.Targets, targets) {
+					return true
+				}
+			}
+		}
+		if !found {
+			return true
+		}
+	}
+	return false
+}
+
+func sameTargets(a, b []pagerduty.APIObject) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n := range a {
+		if a[n].ID != b[n].ID || a[n].Type != b[n].Type {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+const pagerDutyHistoryFile = "pagerduty_history"
+
+// pagerDutyHistory - backup shifts per policy, range start and person; ranges are
+// overwritten when planned again so re-running the same week is not counted twice
+type pagerDutyHistory map[string]map[string]map[string]int
+
+// pagerDutyPlacement - deterministic placement state for single policy and date range
+type pagerDutyPlacement struct {
+	seed int64
+	// backup shifts from earlier ranges (history) and from this range (as it is planned)
+	backups map[string]int
+	// group -> person who took primary slot of the group earlier in the range
+	primaryHolders map[string]string
+	// person -> backup slot used earlier in the range
+	backupHolders map[string]string
+	// backup shifts in this range, stored in history once plan is applied
+	planned map[string]int
+}
+
+func loadPagerDutyHistory(ctx *RuntimeContext) pagerDutyHistory {
+	history := make(pagerDutyHistory)
+	data, err := loadState(ctx, pagerDutyHistoryFile)
+	if err != nil {
+		return history
+	}
+	if err = json.Unmarshal(data, &history); err != nil {
+		logWarn(ctx, "", "Unable to parse PagerDuty history, starting from scratch")
+		return make(pagerDutyHistory)
+	}
+	return history
+}
+
+func savePagerDutyHistory(ctx *RuntimeContext, history pagerDutyHistory) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return saveState(ctx, pagerDutyHistoryFile, data)
+}
+
+func (h pagerDutyHistory) record(policyID string, startDate time.Time, planned map[string]int) {
+	if h[policyID] == nil {
+		h[policyID] = make(map[string]map[string]int)
+	}
+	h[policyID][startDate.Format("2006-01-02")] = planned
+}
+
+func newPagerDutyPlacement(history pagerDutyHistory, policyID string, startDate time.Time, seed int64) *pagerDutyPlacement {
+	placement := &pagerDutyPlacement{
+		seed:           seed,
+		backups:        make(map[string]int),
+		primaryHolders: make(map[string]string),
+		backupHolders:  make(map[string]string),
+		planned:        make(map[string]int),
+	}
+	// only ranges before this one count, so planning a later week ahead does not change this one
+	rangeKey := startDate.Format("2006-01-02")
+	for key, counts := range history[policyID] {
+		if key >= rangeKey {
+			continue
+		}
+		for name, count := range counts {
+			placement.backups[name] += count
+		}
+	}
+	return placement
+}
+
+func (p *pagerDutyPlacement) tieBreaker(name string) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%s", p.seed, name)
+	return h.Sum64()
+}
+
+// order sorts people of a day so that those placed first get their group slot:
+// holders of the slot from earlier days, then people with more backup duty, then seeded hash
+func (p *pagerDutyPlacement) order(names []NameGroup) []NameGroup {
+	ordered := make([]NameGroup, len(names))
+	copy(ordered, names)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		aHolder := p.primaryHolders[a.Group] == a.Name
+		bHolder := p.primaryHolders[b.Group] == b.Name
+		if aHolder != bHolder {
+			return aHolder
+		}
+		if p.backups[a.Name] != p.backups[b.Name] {
+			return p.backups[a.Name] > p.backups[b.Name]
+		}
+		return p.tieBreaker(a.Name) < p.tieBreaker(b.Name)
+	})
+	return ordered
+}
+
+// backupOrder returns backup slots, slot used by the person earlier in the range first
+func (p *pagerDutyPlacement) backupOrder(name string, backupSlotsCount int) []string {
+	slots := make([]string, 0, backupSlotsCount)
+	if previous, ok := p.backupHolders[name]; ok {
+		slots = append(slots, previous)
+	}
+	for i := 0; i < backupSlotsCount; i++ {
+		slot := fmt.Sprintf("Backup%d", i+1)
+		if !contains(slots, slot) {
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+func (p *pagerDutyPlacement) placedPrimary(name NameGroup) {
+	if _, ok := p.primaryHolders[name.Group]; !ok {
+		p.primaryHolders[name.Group] = name.Name
+	}
+}
+
+func (p *pagerDutyPlacement) placedBackup(name NameGroup, slot string) {
+	p.backupHolders[name.Name] = slot
+	p.backups[name.Name]++
+	p.planned[name.Name]++
+}
+
+// deterministicSlotSuffix replaces random schedule name suffix, so names are reproducible
+func deterministicSlotSuffix(seed int64, name string) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d|%s", seed, name)
+	return fmt.Sprintf("%06X", h.Sum32()&0xFFFFFF)
+}
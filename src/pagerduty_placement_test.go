@@ -0,0 +1,278 @@
+package src
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func names(groupAndNames ...string) []NameGroup {
+	result := make([]NameGroup, 0, len(groupAndNames)/2)
+	for n := 0; n+1 < len(groupAndNames); n += 2 {
+		result = append(result, NameGroup{Group: groupAndNames[n], Name: groupAndNames[n+1]})
+	}
+	return result
+}
+
+func nameList(names []NameGroup) []string {
+	result := make([]string, len(names))
+	for n := range names {
+		result[n] = names[n].Name
+	}
+	return result
+}
+
+// placeWeek places people of every day the way planPagerDutyTiers does, first person of a group
+// takes its slot, others go to backup slots; returns placed slot per day and person
+func placeWeek(placement *pagerDutyPlacement, days [][]NameGroup, backupSlotsCount int) []map[string]string {
+	placed := make([]map[string]string, len(days))
+	for n, day := range days {
+		placed[n] = make(map[string]string)
+		taken := make(map[string]bool)
+		for _, name := range placement.order(day) {
+			if !taken[name.Group] {
+				taken[name.Group] = true
+				placed[n][name.Name] = name.Group
+				placement.placedPrimary(name)
+				continue
+			}
+			for _, slot := range placement.backupOrder(name.Name, backupSlotsCount) {
+				if !taken[slot] {
+					taken[slot] = true
+					placed[n][name.Name] = slot
+					placement.placedBackup(name, slot)
+					break
+				}
+			}
+		}
+	}
+	return placed
+}
+
+func workWeek(day []NameGroup) [][]NameGroup {
+	return [][]NameGroup{day, day, day, day, day}
+}
+
+func TestPagerDutyPlacementOrder(t *testing.T) {
+	start := time.Date(2022, 9, 5, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		history  pagerDutyHistory
+		holders  map[string]string
+		input    []NameGroup
+		expected []string
+	}{
+		{
+			name:     "holder of group slot goes first",
+			holders:  map[string]string{"L1": "Bob"},
+			input:    names("L1", "Alice", "L1", "Bob"),
+			expected: []string{"Bob", "Alice"},
+		},
+		{
+			name: "more backup duty in history goes first",
+			history: pagerDutyHistory{"P1": {
+				"2022-08-29": {"Alice": 1, "Bob": 4},
+				"2022-08-22": {"Alice": 2},
+			}},
+			input:    names("L1", "Alice", "L1", "Bob"),
+			expected: []string{"Bob", "Alice"},
+		},
+		{
+			name:     "history of the planned range itself is ignored",
+			history:  pagerDutyHistory{"P1": {"2022-09-05": {"Bob": 5}, "2022-08-29": {"Alice": 1}}},
+			input:    names("L1", "Bob", "L1", "Alice"),
+			expected: []string{"Alice", "Bob"},
+		},
+		{
+			name:     "history of later range is ignored",
+			history:  pagerDutyHistory{"P1": {"2022-09-12": {"Bob": 5}, "2022-08-29": {"Alice": 1}}},
+			input:    names("L1", "Bob", "L1", "Alice"),
+			expected: []string{"Alice", "Bob"},
+		},
+		{
+			name:     "history of other policy is ignored",
+			history:  pagerDutyHistory{"P2": {"2022-08-29": {"Bob": 5}}, "P1": {"2022-08-29": {"Alice": 1}}},
+			input:    names("L1", "Bob", "L1", "Alice"),
+			expected: []string{"Alice", "Bob"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			placement := newPagerDutyPlacement(test.history, "P1", start, 0)
+			for group, holder := range test.holders {
+				placement.primaryHolders[group] = holder
+			}
+			actual := nameList(placement.order(test.input))
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPagerDutyPlacementIsReproducible(t *testing.T) {
+	start := time.Date(2022, 9, 5, 0, 0, 0, 0, time.UTC)
+	history := pagerDutyHistory{"P1": {"2022-08-29": {"Carol": 2, "Dave": 2}}}
+	day := names("L1", "Alice", "L1", "Bob", "L1", "Carol", "L2", "Dave", "L2", "Erin")
+	tests := []struct {
+		name string
+		seed int64
+	}{
+		{name: "default seed", seed: 0},
+		{name: "custom seed", seed: 42},
+		{name: "negative seed", seed: -7},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			first := placeWeek(newPagerDutyPlacement(history, "P1", start, test.seed), workWeek(day), 3)
+			second := placeWeek(newPagerDutyPlacement(history, "P1", start, test.seed), workWeek(day), 3)
+			if !reflect.DeepEqual(first, second) {
+				t.Errorf("same seed and history placed differently: %v and %v", first, second)
+			}
+		})
+	}
+}
+
+func TestPagerDutyPlacementSeedBreaksTies(t *testing.T) {
+	start := time.Date(2022, 9, 5, 0, 0, 0, 0, time.UTC)
+	day := names("L1", "Alice", "L1", "Bob", "L1", "Carol", "L1", "Dave")
+	orders := make(map[string]bool)
+	for seed := int64(0); seed < 16; seed++ {
+		placement := newPagerDutyPlacement(pagerDutyHistory{}, "P1", start, seed)
+		orders[fmt.Sprint(nameList(placement.order(day)))] = true
+	}
+	if len(orders) < 2 {
+		t.Errorf("expected different seeds to produce different orders, got %v", orders)
+	}
+}
+
+func TestPagerDutyPlacementBackupOrder(t *testing.T) {
+	tests := []struct {
+		name             string
+		previous         map[string]string
+		person           string
+		backupSlotsCount int
+		expected         []string
+	}{
+		{
+			name:             "slots in order without previous placement",
+			person:           "Alice",
+			backupSlotsCount: 3,
+			expected:         []string{"Backup1", "Backup2", "Backup3"},
+		},
+		{
+			name:             "previously used slot first",
+			previous:         map[string]string{"Alice": "Backup2"},
+			person:           "Alice",
+			backupSlotsCount: 3,
+			expected:         []string{"Backup2", "Backup1", "Backup3"},
+		},
+		{
+			name:             "slot of other person does not matter",
+			previous:         map[string]string{"Bob": "Backup2"},
+			person:           "Alice",
+			backupSlotsCount: 2,
+			expected:         []string{"Backup1", "Backup2"},
+		},
+		{
+			name:             "no backup slots",
+			person:           "Alice",
+			backupSlotsCount: 0,
+			expected:         []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			placement := newPagerDutyPlacement(pagerDutyHistory{}, "P1", time.Now(), 0)
+			for name, slot := range test.previous {
+				placement.backupHolders[name] = slot
+			}
+			actual := placement.backupOrder(test.person, test.backupSlotsCount)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPagerDutyPlacementBalancesBackupsAcrossWeeks(t *testing.T) {
+	tests := []struct {
+		name             string
+		day              []NameGroup
+		backupSlotsCount int
+		weeks            int
+		maxDifference    int
+		// backups recorded for a week after the planned ones (planned ahead), not to be taken into account
+		later map[string]int
+	}{
+		{
+			name:             "two people sharing group",
+			day:              names("L1", "Alice", "L1", "Bob"),
+			backupSlotsCount: 1,
+			weeks:            4,
+			maxDifference:    0,
+		},
+		{
+			name:             "three people sharing group",
+			day:              names("L1", "Alice", "L1", "Bob", "L1", "Carol"),
+			backupSlotsCount: 2,
+			weeks:            6,
+			maxDifference:    0,
+		},
+		{
+			name:             "two groups",
+			day:              names("L1", "Alice", "L1", "Bob", "L2", "Carol", "L2", "Dave"),
+			backupSlotsCount: 2,
+			weeks:            4,
+			maxDifference:    0,
+		},
+		{
+			name:             "later week already planned",
+			day:              names("L1", "Alice", "L1", "Bob", "L1", "Carol"),
+			backupSlotsCount: 2,
+			weeks:            6,
+			maxDifference:    0,
+			later:            map[string]int{"Alice": 10, "Bob": 3},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history := make(pagerDutyHistory)
+			start := time.Date(2022, 9, 5, 0, 0, 0, 0, time.UTC)
+			laterStart := start.AddDate(0, 0, 7*(test.weeks+1))
+			if test.later != nil {
+				history.record("P1", laterStart, test.later)
+			}
+			for week := 0; week < test.weeks; week++ {
+				weekStart := start.AddDate(0, 0, 7*week)
+				placement := newPagerDutyPlacement(history, "P1", weekStart, 0)
+				placeWeek(placement, workWeek(test.day), test.backupSlotsCount)
+				history.record("P1", weekStart, placement.planned)
+			}
+
+			totals := make(map[string]int)
+			for key, counts := range history["P1"] {
+				if key == laterStart.Format("2006-01-02") {
+					continue
+				}
+				for name, count := range counts {
+					totals[name] += count
+				}
+			}
+			min, max := -1, 0
+			for _, name := range test.day {
+				count := totals[name.Name]
+				if min < 0 || count < min {
+					min = count
+				}
+				if count > max {
+					max = count
+				}
+			}
+			if max-min > test.maxDifference {
+				t.Errorf("backups are not balanced after %d weeks: %v", test.weeks, totals)
+			}
+		})
+	}
+}
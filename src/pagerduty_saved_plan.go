@@ -0,0 +1,180 @@
+package src
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+// pagerDutySavedPlan - desired PagerDuty layout written with -plan-out, so it can be
+// reviewed and later applied with -apply-plan without reading spreadsheet again
+type pagerDutySavedPlan struct {
+	StartDate time.Time               `json:"startDate"`
+	EndDate   time.Time               `json:"endDate"`
+	Seed      int64                   `json:"seed"`
+	Policies  []*pagerDutySavedPolicy `json:"policies"`
+}
+
+type pagerDutySavedPolicy struct {
+	GroupName       string                       `json:"groupName"`
+	PagerDuty       *PagerDutyConfig             `json:"pagerDuty"`
+	Groups          []string                     `json:"groups"`
+	TierAssignments [][]*PagerDutyTierAssignment `json:"tierAssignments"`
+	BackupDuty      map[string]int               `json:"backupDuty"`
+}
+
+// pagerDutyAppliedFile - tier assignments applied per policy and range start, verification compares
+// live on-call with them instead of planning again (history and seed may differ since)
+const pagerDutyAppliedFile = "pagerduty_applied"
+
+// pagerDutyAppliedKeepDays - applied ranges older than this are dropped when new one is stored
+const pagerDutyAppliedKeepDays = 56
+
+type pagerDutyApplied struct {
+	TierIDs         []string                     `json:"tierIDs"`
+	TierAssignments [][]*PagerDutyTierAssignment `json:"tierAssignments"`
+}
+
+// pagerDutyAppliedPlans - policy ID -> range start -> applied tier assignments
+type pagerDutyAppliedPlans map[string]map[string]*pagerDutyApplied
+
+func loadPagerDutyAppliedPlans(ctx *RuntimeContext) pagerDutyAppliedPlans {
+	applied := make(pagerDutyAppliedPlans)
+	data, err := loadState(ctx, pagerDutyAppliedFile)
+	if err != nil {
+		return applied
+	}
+	if err = json.Unmarshal(data, &applied); err != nil {
+		logWarn(ctx, "", "Unable to parse applied PagerDuty plans, tiers will not be verified")
+		return make(pagerDutyAppliedPlans)
+	}
+	return applied
+}
+
+func (a pagerDutyAppliedPlans) record(plan *pagerDutyPlan) {
+	if a[plan.pd.PolicyID] == nil {
+		a[plan.pd.PolicyID] = make(map[string]*pagerDutyApplied)
+	}
+	oldest := plan.startDate.AddDate(0, 0, -pagerDutyAppliedKeepDays).Format("2006-01-02")
+	for key := range a[plan.pd.PolicyID] {
+		if key < oldest {
+			delete(a[plan.pd.PolicyID], key)
+		}
+	}
+	a[plan.pd.PolicyID][plan.startDate.Format("2006-01-02")] = &pagerDutyApplied{
+		TierIDs:         plan.pd.TierIDs,
+		TierAssignments: plan.tierAssignments,
+	}
+}
+
+// lookup returns tier assignments applied for the range as plan, nil when the range was not applied
+func (a pagerDutyAppliedPlans) lookup(policyID string, startDate time.Time) *pagerDutyPlan {
+	applied, ok := a[policyID][startDate.Format("2006-01-02")]
+	if !ok || len(applied.TierAssignments) != len(applied.TierIDs) {
+		return nil
+	}
+	return &pagerDutyPlan{
+		pd:              &PagerDutyConfig{PolicyID: policyID, TierIDs: applied.TierIDs},
+		tierAssignments: applied.TierAssignments,
+		startDate:       startDate,
+	}
+}
+
+func savePagerDutyAppliedPlan(ctx *RuntimeContext, plan *pagerDutyPlan) error {
+	applied := loadPagerDutyAppliedPlans(ctx)
+	applied.record(plan)
+	data, err := json.Marshal(applied)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return saveState(ctx, pagerDutyAppliedFile, data)
+}
+
+func savedPolicyFromPlan(plan *pagerDutyPlan) *pagerDutySavedPolicy {
+	return &pagerDutySavedPolicy{
+		GroupName:       plan.cfg.GroupName,
+		PagerDuty:       plan.pd,
+		Groups:          plan.groups,
+		TierAssignments: plan.tierAssignments,
+		BackupDuty:      plan.placement.planned,
+	}
+}
+
+func savePagerDutyPlan(ctx *RuntimeContext, saved *pagerDutySavedPlan) error {
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	err = ctx.io.SaveBytes(ctx.PlanOut, data)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	logInfo(ctx, "", "Plan saved to '%s', apply it with -apply-plan", ctx.PlanOut)
+	return nil
+}
+
+// ApplyPagerDutyPlan - applies plan saved with -plan-out exactly as it was saved
+func ApplyPagerDutyPlan(ctx *RuntimeContext, name string) {
+	err := applySavedPagerDutyPlan(ctx, name)
+	if err != nil {
+		logError(ctx, "", err, "Unable to apply saved plan")
+	}
+}
+
+func applySavedPagerDutyPlan(ctx *RuntimeContext, name string) error {
+	data, err := ctx.io.LoadBytes(name)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	var saved pagerDutySavedPlan
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	history := loadPagerDutyHistory(ctx)
+	for _, policy := range saved.Policies {
+		var cfg *AssignmentsConfig
+		for _, c := range ctx.Configs {
+			if c.GroupName == policy.GroupName {
+				cfg = c
+			}
+		}
+		if cfg == nil || policy.PagerDuty == nil {
+			return errors.Errorf("Plan refers to group '%s' which is not configured", policy.GroupName)
+		}
+		if len(policy.TierAssignments) != len(policy.PagerDuty.TierIDs) {
+			return errors.Errorf("Plan for policy id='%s' does not match its tiers", policy.PagerDuty.PolicyID)
+		}
+		logInfo(ctx, cfg.GroupName, "Applying saved plan for policy ID='%s'", policy.PagerDuty.PolicyID)
+
+		assignments := make(map[string]*PagerDutyTierAssignment)
+		for _, tier := range policy.TierAssignments {
+			for _, assignment := range tier {
+				assignments[assignment.Group] = assignment
+			}
+		}
+		placement := newPagerDutyPlacement(nil, policy.PagerDuty.PolicyID, saved.StartDate, saved.Seed)
+		if policy.BackupDuty != nil {
+			placement.planned = policy.BackupDuty
+		}
+		plan := &pagerDutyPlan{
+			cfg:             cfg,
+			pd:              policy.PagerDuty,
+			groups:          policy.Groups,
+			assignments:     assignments,
+			tierAssignments: policy.TierAssignments,
+			placement:       placement,
+			startDate:       saved.StartDate,
+			endDate:         saved.EndDate,
+		}
+		logPagerDutyLayout(ctx, plan)
+
+		err = applyPagerDutyPlan(ctx, plan, history)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
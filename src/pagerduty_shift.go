@@ -0,0 +1,102 @@
+package src
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+const (
+	defaultPagerDutyTimeZone   = "Europe/Warsaw"
+	defaultPagerDutyShiftStart = "16:00"
+	// weekend shift starts on Friday and lasts until Sunday's shift ends
+	weekendShiftExtension = 48 * time.Hour
+)
+
+// dutyShift - daily shift of policy, starting at the same local time every day
+type dutyShift struct {
+	location *time.Location
+	start    time.Time
+	duration time.Duration
+	weekend  bool
+}
+
+func pagerDutyShiftFor(pd *PagerDutyConfig) (*dutyShift, error) {
+	owner := fmt.Sprintf("policy id='%s'", pd.PolicyID)
+	return newDutyShift(owner, pd.TimeZone, pd.ShiftStart, pd.ShiftDuration, pd.WeekendShift)
+}
+
+func newDutyShift(owner, timeZone, shiftStart, shiftDuration string, weekend bool) (*dutyShift, error) {
+	shift := &dutyShift{duration: pagerDutyShiftDuration, weekend: weekend}
+
+	var err error
+	if timeZone == "" {
+		shift.location, err = time.LoadLocation(defaultPagerDutyTimeZone)
+		if err != nil {
+			shift.location = time.UTC
+		}
+	} else {
+		shift.location, err = time.LoadLocation(timeZone)
+		if err != nil {
+			return nil, errors.Errorf("Invalid time zone '%s' for %s", timeZone, owner)
+		}
+	}
+
+	if shiftStart == "" {
+		shiftStart = defaultPagerDutyShiftStart
+	}
+	shift.start, err = time.Parse("15:04", shiftStart)
+	if err != nil {
+		return nil, errors.Errorf("Invalid shift start '%s' for %s, HH:MM expected", shiftStart, owner)
+	}
+
+	if shiftDuration != "" {
+		shift.duration, err = time.ParseDuration(shiftDuration)
+		if err != nil || shift.duration <= 0 || shift.duration > 24*time.Hour {
+			return nil, errors.Errorf("Invalid shift duration '%s' for %s", shiftDuration, owner)
+		}
+	}
+	return shift, nil
+}
+
+// days returns days covered by shifts, in weekend mode Friday covers Saturday and Sunday
+func (s *dutyShift) days(cfg *AssignmentsConfig, schedule []AssignmentsScheduleEntry) []AssignmentsScheduleEntry {
+	days := make([]AssignmentsScheduleEntry, 0, len(schedule))
+	for _, entry := range schedule {
+		if !isWorkingDay(cfg, entry.Date) {
+			continue
+		}
+		if s.weekend && isWeekend(entry.Date) {
+			continue
+		}
+		days = append(days, entry)
+	}
+	return days
+}
+
+// startOf returns shift start (UTC) and duration for given day
+func (s *dutyShift) startOf(date time.Time) (time.Time, time.Duration) {
+	local := time.Date(date.Year(), date.Month(), date.Day(), s.start.Hour(), s.start.Minute(), 0, 0, s.location)
+	duration := s.duration
+	if s.weekend && date.Weekday() == time.Friday {
+		duration += weekendShiftExtension
+	}
+	return local.In(time.UTC), duration
+}
+
+// isoWeekday - PagerDuty restrictions use ISO days of week (Monday = 1, Sunday = 7)
+func isoWeekday(date time.Time) uint {
+	if date.Weekday() == time.Sunday {
+		return 7
+	}
+	return uint(date.Weekday())
+}
+
+// slotDuration - plans saved before shifts were configurable have no duration
+func slotDuration(a *PagerDutySlotAssignment) time.Duration {
+	if a.Duration == 0 {
+		return pagerDutyShiftDuration
+	}
+	return a.Duration
+}
@@ -0,0 +1,254 @@
+package src
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/go-errors/errors"
+)
+
+// expectedOnCall - person planned for shift with escalation levels of tiers holding their slots,
+// no levels when the tier is not known (range not applied by the app), any level is fine then
+type expectedOnCall struct {
+	userID string
+	name   string
+	levels []uint
+}
+
+// VerifyPagerDutySchedule - compares live PagerDuty on-call with spreadsheet, returns number of problems found
+func VerifyPagerDutySchedule(ctx *RuntimeContext, startDate, endDate time.Time) int {
+	problems, err := verifyPagerDutySchedule(ctx, startDate, endDate)
+	if err != nil {
+		logError(ctx, "", err, "Unable to verify PagerDuty schedule")
+		return problems + 1
+	}
+	return problems
+}
+
+func ruleLevel(policy *pagerduty.EscalationPolicy, ruleID string) uint {
+	for n, rule := range policy.EscalationRules {
+		if rule.ID == ruleID {
+			return uint(n + 1)
+		}
+	}
+	return 0
+}
+
+func containsLevel(levels []uint, level uint) bool {
+	for _, l := range levels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+func listOnCalls(ctx *RuntimeContext, opts pagerduty.ListOnCallOptions) ([]pagerduty.OnCall, error) {
+	onCalls := make([]pagerduty.OnCall, 0)
+	opts.Limit = pagerDutyPageLimit
+	for {
+		response, err := ctx.pagerduty.ListOnCalls(opts)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		onCalls = append(onCalls, response.OnCalls...)
+		if !response.More {
+			break
+		}
+		opts.Offset += opts.Limit
+	}
+	return onCalls, nil
+}
+
+// expectedOnCalls returns people expected to be on call per shift start (UTC) with levels of tiers
+// their slots were planned to, so people landing in a wrong tier are reported
+func expectedOnCalls(plan *pagerDutyPlan, policy *pagerduty.EscalationPolicy) map[time.Time]map[string]*expectedOnCall {
+	expected := make(map[time.Time]map[string]*expectedOnCall)
+	for n, tierID := range plan.pd.TierIDs {
+		level := ruleLevel(policy, tierID)
+		for _, tier := range plan.tierAssignments[n] {
+			for _, a := range tier.Assignments {
+				start := a.Start.In(time.UTC)
+				if expected[start] == nil {
+					expected[start] = make(map[string]*expectedOnCall)
+				}
+				parts := strings.SplitN(a.User, "|", 2)
+				e, ok := expected[start][parts[0]]
+				if !ok {
+					e = &expectedOnCall{userID: parts[0], name: parts[len(parts)-1]}
+					expected[start][parts[0]] = e
+				}
+				if !containsLevel(e.levels, level) {
+					e.levels = append(e.levels, level)
+				}
+			}
+		}
+	}
+	return expected
+}
+
+// shiftSample - start (UTC) of shift and time in its middle, when on-call is checked
+type shiftSample struct {
+	start time.Time
+	at    time.Time
+}
+
+// shiftSamples returns every shift of the range, including days nobody is expected on, in weekend
+// mode Friday shift covers Saturday and Sunday; shifts are sampled in the middle, handoff edges are not interesting
+func shiftSamples(shift *dutyShift, startDate, endDate time.Time) []shiftSample {
+	samples := make([]shiftSample, 0)
+	for date := startDate; date.Before(endDate); date = date.AddDate(0, 0, 1) {
+		if shift.weekend && isWeekend(date) {
+			continue
+		}
+		start, duration := shift.startOf(date)
+		samples = append(samples, shiftSample{start: start, at: start.Add(duration / 2)})
+	}
+	return samples
+}
+
+// compareOnCall reports differences of single shift, returns number of problems
+func compareOnCall(ctx *RuntimeContext, group, day string, expected map[string]*expectedOnCall, actual map[string][]uint, actualNames map[string]string) int {
+	problems := 0
+	userIDs := make([]string, 0, len(expected))
+	for userID := range expected {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	for _, userID := range userIDs {
+		e := expected[userID]
+		levels := actual[userID]
+		delete(actual, userID)
+		if len(e.levels) == 0 {
+			if len(levels) == 0 {
+				problems++
+				logWarn(ctx, group, "[%s] gap: %s is not paged", day, e.name)
+			}
+			continue
+		}
+		missing := make([]uint, 0)
+		for _, level := range e.levels {
+			if !containsLevel(levels, level) {
+				missing = append(missing, level)
+			}
+		}
+		unexpected := make([]uint, 0)
+		for _, level := range levels {
+			if !containsLevel(e.levels, level) {
+				unexpected = append(unexpected, level)
+			}
+		}
+		for len(missing) > 0 && len(unexpected) > 0 {
+			problems++
+			logWarn(ctx, group, "[%s] wrong tier: %s expected at level %d is paged at level %d", day, e.name, missing[0], unexpected[0])
+			missing, unexpected = missing[1:], unexpected[1:]
+		}
+		for _, level := range missing {
+			problems++
+			logWarn(ctx, group, "[%s] gap: %s expected at level %d is not paged", day, e.name, level)
+		}
+		for _, level := range unexpected {
+			problems++
+			logWarn(ctx, group, "[%s] extra: %s is also paged at level %d", day, e.name, level)
+		}
+	}
+	for userID, levels := range actual {
+		for _, level := range levels {
+			problems++
+			logWarn(ctx, group, "[%s] extra: %s (%s) is paged at level %d", day, actualNames[userID], userID, level)
+		}
+	}
+	return problems
+}
+
+// expectedLevelsFromApplied keeps people expected by spreadsheet, but takes their levels from the plan
+// actually applied (placement depends on history and seed of the run which applied it); people missing
+// in the applied plan (spreadsheet changed since) and ranges never applied can be paged at any level
+func expectedLevelsFromApplied(expected, applied map[time.Time]map[string]*expectedOnCall) {
+	for start, people := range expected {
+		for userID, e := range people {
+			e.levels = nil
+			if a, ok := applied[start][userID]; ok {
+				e.levels = a.levels
+			}
+		}
+	}
+}
+
+func verifyPagerDutySchedule(ctx *RuntimeContext, startDate, endDate time.Time) (int, error) {
+	problems := 0
+	history := loadPagerDutyHistory(ctx)
+	appliedPlans := loadPagerDutyAppliedPlans(ctx)
+
+	for _, cfg := range ctx.Configs {
+		if cfg.PagerDuty == nil {
+			continue
+		}
+		for _, pd := range cfg.PagerDuty {
+			logInfo(ctx, cfg.GroupName, "Verifying policy ID='%s'", pd.PolicyID)
+
+			// people on each shift come from spreadsheet, their placement is not compared
+			placement := newPagerDutyPlacement(history, pd.PolicyID, startDate, ctx.Seed)
+			plan, err := planPagerDutyTiers(ctx, cfg, pd, startDate, endDate, placement)
+			if err != nil {
+				return problems, err
+			}
+			shift, err := pagerDutyShiftFor(pd)
+			if err != nil {
+				return problems, err
+			}
+			policy, err := ctx.pagerduty.GetEscalationPolicy(pd.PolicyID, &pagerduty.GetEscalationPolicyOptions{})
+			if err != nil {
+				return problems, errors.Errorf("No policy id='%s'", pd.PolicyID)
+			}
+
+			configuredLevels := make([]uint, 0, len(pd.TierIDs))
+			for _, tierID := range pd.TierIDs {
+				configuredLevels = append(configuredLevels, ruleLevel(policy, tierID))
+			}
+
+			expected := expectedOnCalls(plan, policy)
+			var appliedExpected map[time.Time]map[string]*expectedOnCall
+			if applied := appliedPlans.lookup(pd.PolicyID, startDate); applied != nil {
+				appliedExpected = expectedOnCalls(applied, policy)
+			} else {
+				logInfo(ctx, cfg.GroupName, "No plan applied for policy ID='%s' from %s, tiers are not checked", pd.PolicyID, startDate.Format(format))
+			}
+			expectedLevelsFromApplied(expected, appliedExpected)
+			for _, sample := range shiftSamples(shift, startDate, endDate) {
+				onCalls, err := listOnCalls(ctx, pagerduty.ListOnCallOptions{
+					EscalationPolicyIDs: []string{pd.PolicyID},
+					Since:               sample.at.Format(time.RFC3339),
+					Until:               sample.at.Add(time.Minute).Format(time.RFC3339),
+				})
+				if err != nil {
+					return problems, err
+				}
+
+				actual := make(map[string][]uint)
+				actualNames := make(map[string]string)
+				for _, onCall := range onCalls {
+					if !containsLevel(configuredLevels, onCall.EscalationLevel) {
+						continue
+					}
+					if !containsLevel(actual[onCall.User.ID], onCall.EscalationLevel) {
+						actual[onCall.User.ID] = append(actual[onCall.User.ID], onCall.EscalationLevel)
+					}
+					actualNames[onCall.User.ID] = onCall.User.Summary
+				}
+
+				day := sample.start.In(shift.location).Format(format + " 15:04 MST")
+				problems += compareOnCall(ctx, cfg.GroupName, day, expected[sample.start], actual, actualNames)
+			}
+		}
+	}
+
+	if problems == 0 {
+		logInfo(ctx, "", "PagerDuty on-call matches spreadsheet")
+	} else {
+		logWarn(ctx, "", "%d problem(s) found", problems)
+	}
+	return problems, nil
+}
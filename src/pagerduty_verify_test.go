@@ -0,0 +1,75 @@
+package src
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+)
+
+func tierPlan(startDate time.Time, tierIDs []string, users ...[]string) *pagerDutyPlan {
+	tiers := make([][]*PagerDutyTierAssignment, len(users))
+	for n, tierUsers := range users {
+		tier := &PagerDutyTierAssignment{SlotName: tierIDs[n]}
+		for _, user := range tierUsers {
+			tier.Assignments = append(tier.Assignments, &PagerDutySlotAssignment{User: user, Start: startDate, Duration: 24 * time.Hour})
+		}
+		tiers[n] = []*PagerDutyTierAssignment{tier}
+	}
+	return &pagerDutyPlan{pd: &PagerDutyConfig{PolicyID: "P1", TierIDs: tierIDs}, tierAssignments: tiers, startDate: startDate}
+}
+
+func TestPagerDutyAppliedPlans(t *testing.T) {
+	startDate := time.Date(2022, 9, 5, 0, 0, 0, 0, time.UTC)
+	policy := &pagerduty.EscalationPolicy{EscalationRules: []pagerduty.EscalationRule{{ID: "R1"}, {ID: "R2"}}}
+	applied := make(pagerDutyAppliedPlans)
+	applied.record(tierPlan(startDate.AddDate(0, 0, -70), []string{"R1"}, []string{"U0|Old"}))
+	applied.record(tierPlan(startDate, []string{"R1", "R2"}, []string{"U1|Alice"}, []string{"U2|Bob"}))
+
+	data, err := json.Marshal(applied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := make(pagerDutyAppliedPlans)
+	if err = json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded["P1"]) != 1 {
+		t.Errorf("expected old range to be pruned, got %v", loaded["P1"])
+	}
+	if loaded.lookup("P1", startDate.AddDate(0, 0, 7)) != nil {
+		t.Error("expected no plan for range not applied")
+	}
+	plan := loaded.lookup("P1", startDate)
+	if plan == nil {
+		t.Fatal("expected applied plan")
+	}
+
+	// spreadsheet re-plan swapped the tiers and added Carol, levels must follow the applied plan
+	expected := expectedOnCalls(tierPlan(startDate, []string{"R1", "R2"}, []string{"U2|Bob"}, []string{"U1|Alice", "U3|Carol"}), policy)
+	expectedLevelsFromApplied(expected, expectedOnCalls(plan, policy))
+	levels := make(map[string][]uint)
+	for userID, e := range expected[startDate] {
+		levels[userID] = e.levels
+	}
+	if !reflect.DeepEqual(levels, map[string][]uint{"U1": {1}, "U2": {2}, "U3": nil}) {
+		t.Errorf("unexpected levels %v", levels)
+	}
+}
+
+func TestCompareOnCallUnknownLevels(t *testing.T) {
+	ctx := &RuntimeContext{}
+	expected := map[string]*expectedOnCall{
+		"U1": {userID: "U1", name: "Alice"},
+		"U2": {userID: "U2", name: "Bob"},
+		"U3": {userID: "U3", name: "Carol", levels: []uint{1}},
+	}
+	actual := map[string][]uint{"U1": {2}, "U3": {2}}
+	problems := compareOnCall(ctx, "Ops", "2022-09-05", expected, actual, map[string]string{"U1": "Alice", "U3": "Carol"})
+	// Bob is not paged at all, Carol is paged at wrong level, Alice with unknown tier is fine at any level
+	if problems != 2 {
+		t.Errorf("expected 2 problems, got %d", problems)
+	}
+}
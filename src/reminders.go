@@ -0,0 +1,402 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/slack-go/slack"
+)
+
+// reminderHorizonDays - how far (beyond longest reminder) shift starts are looked up
+const reminderHorizonDays = 7
+
+// remindersFile - scheduled messages of reminders per group, only messages recorded there are ever removed
+const remindersFile = "reminders"
+
+// slackTextUnescaper - Slack returns message text with &, < and > escaped
+var slackTextUnescaper = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">")
+
+type shiftStart struct {
+	Name     NameGroup
+	Date     time.Time
+	People   []NameGroup
+	Previous []NameGroup
+}
+
+// scheduledReminder - reminder scheduled in Slack, text is the one sent (Slack returns it escaped)
+type scheduledReminder struct {
+	ID      string `json:"id"`
+	Channel string `json:"channel"`
+	PostAt  int    `json:"postAt"`
+	Text    string `json:"text"`
+}
+
+type plannedReminder struct {
+	group  string
+	userID string
+	postAt time.Time
+	text   string
+	blocks []slack.Block
+}
+
+// getShiftStarts returns days on which people start their shift, ie. they are
+// assigned on given day but were not assigned on previous assigned day
+func getShiftStarts(cfg *AssignmentsConfig, schedule []AssignmentsScheduleEntry, from time.Time) []shiftStart {
+	starts := make([]shiftStart, 0)
+	var previous []NameGroup
+	for _, entry := range schedule {
+		current := entry.Names
+		if len(current) == 0 && cfg.KeepWhenMissing {
+			current = previous
+		}
+		if !entry.Date.Before(from) {
+			for _, name := range current {
+				if containsName(previous, name.Name) {
+					continue
+				}
+				starts = append(starts, shiftStart{
+					Name:     name,
+					Date:     entry.Date,
+					People:   current,
+					Previous: previous,
+				})
+			}
+		}
+		if len(current) > 0 {
+			previous = current
+		}
+	}
+	return starts
+}
+
+func containsName(names []NameGroup, name string) bool {
+	for n := range names {
+		if names[n].Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func reminderPostAt(reminder *ReminderConfig, start time.Time) (time.Time, error) {
+	location := time.UTC
+	if reminder.TimeZone != "" {
+		var err error
+		location, err = time.LoadLocation(reminder.TimeZone)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, 0)
+		}
+	}
+	at := reminder.At
+	if at == "" {
+		at = "09:00"
+	}
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, 0)
+	}
+	day := start.AddDate(0, 0, -reminder.DaysBefore)
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, location), nil
+}
+
+func defaultReminderText(cfg *AssignmentsConfig, user string, reminder *ReminderConfig, start time.Time) string {
+	switch reminder.DaysBefore {
+	case 0:
+		return fmt.Sprintf("Hi there %s, a quick reminder for you: you are on call for *%s* group today!", user, cfg.GroupName)
+	case 1:
+		return fmt.Sprintf("Hi there %s, a quick reminder for you: you are on call for *%s* group tomorrow!", user, cfg.GroupName)
+	default:
+		return fmt.Sprintf(
+			"Hi there %s, a quick reminder for you: you start on call for *%s* group in %d days (%s)!",
+			user,
+			cfg.GroupName,
+			reminder.DaysBefore,
+			start.Format(format),
+		)
+	}
+}
+
+func planReminders(ctx *RuntimeContext, cfg *AssignmentsConfig, now time.Time) ([]*plannedReminder, error) {
+	maxDaysBefore := 0
+	for _, reminder := range cfg.Reminders {
+		if reminder.DaysBefore > maxDaysBefore {
+			maxDaysBefore = reminder.DaysBefore
+		}
+	}
+	today := now.In(time.UTC).Truncate(24 * time.Hour)
+	// look back so shifts which are already in progress are not reported as starting today
+	schedule, err := getDailyAssignmentScheduleForDateRange(
+		ctx,
+		cfg,
+		today.AddDate(0, 0, -adjacentSearchDays),
+		today.AddDate(0, 0, maxDaysBefore+reminderHorizonDays),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	planned := make([]*plannedReminder, 0)
+	for _, start := range getShiftStarts(cfg, schedule, today) {
+		user := matchUserToNameGroup(ctx, start.Name)
+		if user == nil {
+			logWarn(ctx, cfg.GroupName, "Unable to match spreadsheet name '%s' to slack user", start.Name.Name)
+			continue
+		}
+		for _, reminder := range cfg.Reminders {
+			postAt, err := reminderPostAt(reminder, start.Date)
+			if err != nil {
+				return nil, err
+			}
+			if !postAt.After(now) {
+				continue
+			}
+			text := defaultReminderText(cfg, user.RealName, reminder, start.Date)
+			var blocks []slack.Block
+			if reminder.Template != "" || reminder.BlocksTemplate != "" {
+				data := templateDataForDay(ctx, cfg, &assignmentDay{
+					Date:     start.Date,
+					Previous: start.Previous,
+					Current:  start.People,
+				})
+				person := toTemplatePerson(ctx, start.Name)
+				data.Person = &person
+				data.Role = start.Name.Group
+				if reminder.Template != "" {
+					text, err = renderTemplate("reminder", reminder.Template, data)
+					if err != nil {
+						return nil, err
+					}
+				}
+				blocks, err = renderMessageBlocks("reminder", reminder.Template, reminder.BlocksTemplate, data)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if blocks == nil {
+				blocks = []slack.Block{sectionBlockFor(text)}
+			}
+			planned = append(planned, &plannedReminder{
+				group:  cfg.GroupName,
+				userID: user.ID,
+				postAt: postAt,
+				text:   text,
+				blocks: blocks,
+			})
+		}
+	}
+	return planned, nil
+}
+
+// ScheduleReminders -
+func ScheduleReminders(ctx *RuntimeContext, now time.Time) {
+	err := scheduleReminders(ctx, now)
+	if err != nil {
+		logError(ctx, "", err, "Unable to schedule reminders")
+	}
+}
+
+func loadScheduledReminders(ctx *RuntimeContext) (map[string][]*scheduledReminder, error) {
+	stored := make(map[string][]*scheduledReminder)
+	data, err := loadState(ctx, remindersFile)
+	if err == errNoStateStorage {
+		return nil, err
+	} else if err != nil {
+		return stored, nil
+	}
+	if err = json.Unmarshal(data, &stored); err != nil {
+		logWarn(ctx, "", "Unable to parse scheduled reminders, reminders scheduled so far are kept in Slack")
+		return make(map[string][]*scheduledReminder), nil
+	}
+	return stored, nil
+}
+
+func saveScheduledReminders(ctx *RuntimeContext, stored map[string][]*scheduledReminder) error {
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return saveState(ctx, remindersFile, data)
+}
+
+func scheduleReminders(ctx *RuntimeContext, now time.Time) error {
+	stored, err := loadScheduledReminders(ctx)
+	if err == errNoStateStorage {
+		return errors.Errorf("Reminders need state storage to track scheduled messages")
+	}
+
+	planned := make([]*plannedReminder, 0)
+	// outdated reminders are removed only for groups planned successfully
+	plannedGroups := make(map[string]bool)
+	for _, cfg := range ctx.Configs {
+		if len(ctx.FilterGroups) > 0 && !strings.Contains(ctx.FilterGroups, cfg.GroupName) {
+			continue
+		}
+		if len(cfg.Reminders) == 0 {
+			continue
+		}
+		groupPlanned, err := planReminders(ctx, cfg, now)
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Unable to plan reminders")
+			continue
+		}
+		planned = append(planned, groupPlanned...)
+		plannedGroups[cfg.GroupName] = true
+	}
+
+	existing, err := getScheduledMessages(ctx)
+	if err != nil {
+		return err
+	}
+
+	// reminders already sent (or removed in Slack) are forgotten
+	kept := make(map[string]map[string]*scheduledReminder)
+	for group := range plannedGroups {
+		kept[group] = make(map[string]*scheduledReminder)
+		for _, reminder := range stored[group] {
+			if _, ok := existing[reminder.ID]; ok {
+				kept[group][reminder.ID] = reminder
+			}
+		}
+	}
+
+	channels := make(map[string]string)
+	desired := make(map[string]bool)
+	scheduled := make([]*scheduledReminder, 0)
+	scheduledGroups := make([]string, 0)
+	for _, reminder := range planned {
+		channelID, ok := channels[reminder.userID]
+		if !ok {
+			channel, _, _, err := ctx.slack.OpenConversation(&slack.OpenConversationParameters{
+				Users: []string{reminder.userID},
+			})
+			if err != nil {
+				logError(ctx, reminder.group, err, "Unable to open conversation with %s", reminder.userID)
+				continue
+			}
+			channelID = channel.ID
+			channels[reminder.userID] = channelID
+		}
+		entry := &scheduledReminder{Channel: channelID, PostAt: int(reminder.postAt.Unix()), Text: reminder.text}
+		if id := findScheduledReminder(kept[reminder.group], entry); id != "" {
+			desired[id] = true
+			continue
+		}
+		logInfo(ctx, reminder.group, "Scheduling reminder for %s at %s", reminder.userID, reminder.postAt.Format(time.RFC3339))
+		_, _, err = ctx.slack.ScheduleMessage(
+			channelID,
+			strconv.FormatInt(reminder.postAt.Unix(), 10),
+			slack.MsgOptionText(reminder.text, false),
+			slack.MsgOptionBlocks(reminder.blocks...),
+		)
+		if err != nil {
+			logError(ctx, reminder.group, err, "Unable to schedule reminder for %s", reminder.userID)
+			continue
+		}
+		scheduled = append(scheduled, entry)
+		scheduledGroups = append(scheduledGroups, reminder.group)
+	}
+
+	for group, reminders := range kept {
+		for id, reminder := range reminders {
+			if desired[id] {
+				continue
+			}
+			logInfo(ctx, group, "Removing outdated reminder %s in %s", id, reminder.Channel)
+			_, err = ctx.slack.DeleteScheduledMessage(&slack.DeleteScheduledMessageParameters{
+				Channel:            reminder.Channel,
+				ScheduledMessageID: id,
+			})
+			if err != nil {
+				// kept, so it is removed by the next run
+				logError(ctx, group, err, "Unable to remove reminder %s", id)
+				continue
+			}
+			delete(reminders, id)
+		}
+	}
+
+	if len(scheduled) > 0 {
+		assignScheduledReminderIDs(ctx, existing, scheduled, scheduledGroups, kept)
+	}
+
+	for group, reminders := range kept {
+		stored[group] = make([]*scheduledReminder, 0, len(reminders))
+		for _, reminder := range reminders {
+			stored[group] = append(stored[group], reminder)
+		}
+		sort.Slice(stored[group], func(i, j int) bool { return stored[group][i].ID < stored[group][j].ID })
+	}
+	return saveScheduledReminders(ctx, stored)
+}
+
+// findScheduledReminder returns ID of reminder scheduled for the same channel, time and text
+func findScheduledReminder(reminders map[string]*scheduledReminder, entry *scheduledReminder) string {
+	for id, reminder := range reminders {
+		if reminder.Channel == entry.Channel && reminder.PostAt == entry.PostAt && reminder.Text == entry.Text {
+			return id
+		}
+	}
+	return ""
+}
+
+// assignScheduledReminderIDs looks up IDs of reminders scheduled in this run (chat.scheduleMessage response
+// is not exposed by the client) among scheduled messages which were not there before, and records them
+func assignScheduledReminderIDs(ctx *RuntimeContext, before map[string]slack.ScheduledMessage,
+	scheduled []*scheduledReminder, groups []string, kept map[string]map[string]*scheduledReminder) {
+	after, err := getScheduledMessages(ctx)
+	if err != nil {
+		logError(ctx, "", err, "Unable to look up scheduled reminders, they will not be updated by next runs")
+		return
+	}
+	ids := make([]string, 0)
+	for id := range after {
+		if _, ok := before[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	claimed := make(map[string]bool)
+	for n, entry := range scheduled {
+		for _, id := range ids {
+			message := after[id]
+			if claimed[id] || message.Channel != entry.Channel || message.PostAt != entry.PostAt ||
+				slackTextUnescaper.Replace(message.Text) != entry.Text {
+				continue
+			}
+			claimed[id] = true
+			entry.ID = id
+			kept[groups[n]][id] = entry
+			break
+		}
+		if entry.ID == "" {
+			logWarn(ctx, groups[n], "Unable to find scheduled reminder in %s at %d, it will not be updated by next runs", entry.Channel, entry.PostAt)
+		}
+	}
+}
+
+// getScheduledMessages returns scheduled messages of the bot by ID
+func getScheduledMessages(ctx *RuntimeContext) (map[string]slack.ScheduledMessage, error) {
+	messages := make(map[string]slack.ScheduledMessage)
+	cursor := ""
+	for {
+		page, nextCursor, err := ctx.slack.GetScheduledMessages(&slack.GetScheduledMessagesParameters{
+			Cursor: cursor,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		for _, message := range page {
+			messages[message.ID] = message
+		}
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+	return messages, nil
+}
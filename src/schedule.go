@@ -2,7 +2,6 @@ package src
 
 import (
 	"fmt"
-	"log"
 	"strings"
 	"time"
 
@@ -19,18 +18,34 @@ func getScheduleForDate(
 	endDate time.Time,
 	title string,
 ) (string, error) {
-	var b strings.Builder
 	schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, startDate, endDate)
 	if err != nil {
 		return "", errors.Wrap(err, 0)
 	}
+	return scheduleText(ctx, cfg, schedule, title)
+}
+
+func scheduleText(
+	ctx *RuntimeContext,
+	cfg *AssignmentsConfig,
+	schedule []AssignmentsScheduleEntry,
+	title string,
+) (string, error) {
+	var b strings.Builder
+	if cfg.Templates != nil && cfg.Templates.Schedule != "" {
+		return renderTemplate("schedule", cfg.Templates.Schedule, templateDataForSchedule(ctx, cfg, schedule, title))
+	}
 	fmt.Fprintln(&b, cfg.GroupName, title)
 	for _, entry := range schedule {
+		// empty days outside of working days are not worth mentioning
+		if len(entry.Names) == 0 && !isWorkingDay(cfg, entry.Date) {
+			continue
+		}
 		fmt.Fprintf(&b, "%s\t", entry.Date.Format(format))
 		if len(entry.Names) > 0 {
 			names := make([]string, len(entry.Names))
 			for n, name := range entry.Names {
-				user := matchUserToName(ctx, name.Name)
+				user := matchUserToNameGroup(ctx, name)
 				if user != nil {
 					names[n] = fmt.Sprintf("%s (%s @%s)", name.Name, user.RealName, user.Name)
 				} else {
@@ -40,9 +55,6 @@ func getScheduleForDate(
 			fmt.Fprint(&b, strings.Join(names, ", "))
 		} else {
 			if cfg.KeepWhenMissing {
-				if entry.Date.Weekday() == time.Sunday || entry.Date.Weekday() == time.Saturday {
-					continue
-				}
 				fmt.Fprint(&b, "*same as previous day*")
 			} else {
 				fmt.Fprint(&b, "*nobody is assigned*")
@@ -60,30 +72,50 @@ func getScheduleForDateAsSlackBlocks(
 	endDate time.Time,
 	title string,
 ) ([]slack.Block, error) {
-	blocks := make([]slack.Block, 0)
 	schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, startDate, endDate)
 	if err != nil {
 		return nil, errors.Wrap(err, 0)
 	}
+	return scheduleSlackBlocks(ctx, cfg, schedule, title)
+}
+
+func scheduleSlackBlocks(
+	ctx *RuntimeContext,
+	cfg *AssignmentsConfig,
+	schedule []AssignmentsScheduleEntry,
+	title string,
+) ([]slack.Block, error) {
+	blocks := make([]slack.Block, 0)
+	if cfg.Templates != nil {
+		templateBlocks, err := renderMessageBlocks(
+			"schedule",
+			cfg.Templates.Schedule,
+			cfg.Templates.ScheduleBlocks,
+			templateDataForSchedule(ctx, cfg, schedule, title),
+		)
+		if err != nil || templateBlocks != nil {
+			return templateBlocks, err
+		}
+	}
 	blocks = append(blocks, sectionBlockFor(fmt.Sprintln(cfg.GroupName, title)))
 	for _, entry := range schedule {
+		if len(entry.Names) == 0 && !isWorkingDay(cfg, entry.Date) {
+			continue
+		}
 		var assignmentsStr string
 		if len(entry.Names) > 0 {
 			names := make([]string, len(entry.Names))
 			for n, name := range entry.Names {
-				user := matchUserToName(ctx, name.Name)
+				user := matchUserToNameGroup(ctx, name)
 				if user != nil {
 					names[n] = fmt.Sprintf("<@%s>", user.ID)
 				} else {
-					names[n] = fmt.Sprintf("%s (no Slack match!)", name)
+					names[n] = fmt.Sprintf("%s (no Slack match!)", name.Name)
 				}
 			}
 			assignmentsStr = strings.Join(names, ", ")
 		} else {
 			if cfg.KeepWhenMissing {
-				if entry.Date.Weekday() == time.Sunday || entry.Date.Weekday() == time.Saturday {
-					continue
-				}
 				assignmentsStr = "*same as previous day*"
 			} else {
 				assignmentsStr = "*nobody is assigned*"
@@ -97,8 +129,13 @@ func getScheduleForDateAsSlackBlocks(
 	return blocks, nil
 }
 
-// PrintScheduleForDateRange  -
-func PrintScheduleForDateRange(ctx *RuntimeContext, startDate, endDate time.Time, title string) {
+// PrintScheduleForDateRange  - prints schedule of every group, text of groups which could be loaded is printed
+// even when some group fails, machine-readable formats are printed only complete
+func PrintScheduleForDateRange(ctx *RuntimeContext, startDate, endDate time.Time, title string) error {
+	if ctx.Format != "" && ctx.Format != formatText {
+		return printScheduleRecords(ctx, startDate, endDate, title)
+	}
+	failures := make([]string, 0)
 	for _, cfg := range ctx.Configs {
 		if len(ctx.FilterGroups) > 0 && !strings.Contains(ctx.FilterGroups, cfg.GroupName) {
 			continue
@@ -107,31 +144,35 @@ func PrintScheduleForDateRange(ctx *RuntimeContext, startDate, endDate time.Time
 		if err == nil {
 			fmt.Print(s)
 		} else {
-			fmt.Println("Unable to find assignments for", cfg.GroupName)
-			fmt.Println(err)
+			logError(ctx, cfg.GroupName, err, "Unable to find assignments")
+			failures = append(failures, cfg.GroupName)
 		}
 	}
+	if len(failures) > 0 {
+		return errors.Errorf("Unable to print schedule of: %s", strings.Join(failures, ", "))
+	}
+	return nil
 }
 
-// NotifySlackOfScheduleForDateRange  -
+// NotifySlackOfScheduleForDateRange  - announces schedule with notifiers of every group (Slack by default)
 func NotifySlackOfScheduleForDateRange(ctx *RuntimeContext, startDate, endDate time.Time, title string) {
 	for _, cfg := range ctx.Configs {
-		var channelID string
-		if channel := matchChannelToName(ctx, cfg.NotifyChannel); channel != nil {
-			channelID = channel.ID
-		} else {
-			log.Println("Skipping missing or nonexisting channel for group", cfg.GroupName)
+		done := startRun(ctx, "notifySlack", cfg.GroupName)
+		schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, startDate, endDate)
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Unable to load schedule")
+			done(err)
 			continue
 		}
-		blocks, err := getScheduleForDateAsSlackBlocks(ctx, cfg, startDate, endDate, title)
-		if err != nil {
-			log.Println("Unable to notify Slack about schedule for group", cfg.GroupName)
+		var failed error
+		for _, notifier := range notifiersFor(ctx, cfg) {
+			err = notifier.NotifySchedule(ctx, cfg, schedule, title)
+			if err != nil {
+				logError(ctx, cfg.GroupName, err, "Unable to notify %s about schedule", notifier.Name())
+				countBackendError(ctx, strings.ToLower(notifier.Name()))
+				failed = err
+			}
 		}
-
-		ctx.slack.JoinConversation(channelID)
-		ctx.slack.SendMessage(
-			channelID,
-			slack.MsgOptionBlocks(blocks...),
-		)
+		done(failed)
 	}
 }
@@ -0,0 +1,161 @@
+package src
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+// output formats of printSchedule*, text is the default Slack-like one
+const (
+	formatText     = "text"
+	formatJSON     = "json"
+	formatCSV      = "csv"
+	formatMarkdown = "markdown"
+	formatHTML     = "html"
+	formatYAML     = "yaml"
+)
+
+// scheduleRecord - single person assigned to group for a day, with matched Slack and PagerDuty users
+type scheduleRecord struct {
+	Date        string `json:"date"`
+	Group       string `json:"group"`
+	Name        string `json:"name"`
+	Role        string `json:"role"`
+	SlackID     string `json:"slackID"`
+	PagerDutyID string `json:"pagerDutyID"`
+}
+
+var scheduleRecordColumns = []string{"date", "group", "name", "role", "slackID", "pagerDutyID"}
+
+func (r scheduleRecord) values() []string {
+	return []string{r.Date, r.Group, r.Name, r.Role, r.SlackID, r.PagerDutyID}
+}
+
+// scheduleRecords resolves schedule of the group, Slack and PagerDuty IDs are set only when
+// users of these are loaded
+func scheduleRecords(ctx *RuntimeContext, cfg *AssignmentsConfig, schedule []AssignmentsScheduleEntry) []scheduleRecord {
+	records := make([]scheduleRecord, 0, len(schedule))
+	for _, entry := range schedule {
+		for _, name := range entry.Names {
+			record := scheduleRecord{
+				Date:  entry.Date.Format("2006-01-02"),
+				Group: cfg.GroupName,
+				Name:  name.Name,
+				Role:  name.Group,
+			}
+			if len(ctx.users) > 0 {
+				if user := matchUserToNameGroup(ctx, name); user != nil {
+					record.SlackID = user.ID
+				}
+			}
+			if len(ctx.pdUsers) > 0 {
+				if user := matchPDUserToName(ctx, name.Name, configTeams(cfg)); user != nil {
+					record.PagerDutyID = user.ID
+				}
+			}
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// ValidScheduleFormat - verifies -format value
+func ValidScheduleFormat(format string) bool {
+	switch format {
+	case "", formatText, formatJSON, formatCSV, formatMarkdown, formatHTML, formatYAML:
+		return true
+	}
+	return false
+}
+
+func printScheduleRecords(ctx *RuntimeContext, startDate, endDate time.Time, title string) error {
+	records := make([]scheduleRecord, 0)
+	for _, cfg := range ctx.Configs {
+		if len(ctx.FilterGroups) > 0 && !strings.Contains(ctx.FilterGroups, cfg.GroupName) {
+			continue
+		}
+		schedule, err := getDailyAssignmentScheduleForDateRange(ctx, cfg, startDate, endDate)
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+		records = append(records, scheduleRecords(ctx, cfg, schedule)...)
+	}
+	data, err := formatScheduleRecords(ctx.Format, records, title)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+func formatScheduleRecords(format string, records []scheduleRecord, title string) ([]byte, error) {
+	var b bytes.Buffer
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(&b)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(records)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+	case formatCSV:
+		writer := csv.NewWriter(&b)
+		writer.Write(scheduleRecordColumns)
+		for _, record := range records {
+			writer.Write(record.values())
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+	case formatMarkdown:
+		fmt.Fprintf(&b, "| %s |\n", strings.Join(scheduleRecordColumns, " | "))
+		fmt.Fprintf(&b, "|%s\n", strings.Repeat(" --- |", len(scheduleRecordColumns)))
+		for _, record := range records {
+			values := record.values()
+			for n := range values {
+				values[n] = strings.ReplaceAll(values[n], "|", `\|`)
+			}
+			fmt.Fprintf(&b, "| %s |\n", strings.Join(values, " | "))
+		}
+	case formatHTML:
+		fmt.Fprintf(&b, "<table>\n<caption>%s</caption>\n<tr>", html.EscapeString(title))
+		for _, column := range scheduleRecordColumns {
+			fmt.Fprintf(&b, "<th>%s</th>", column)
+		}
+		fmt.Fprint(&b, "</tr>\n")
+		for _, record := range records {
+			fmt.Fprint(&b, "<tr>")
+			for _, value := range record.values() {
+				fmt.Fprintf(&b, "<td>%s</td>", html.EscapeString(value))
+			}
+			fmt.Fprint(&b, "</tr>\n")
+		}
+		fmt.Fprint(&b, "</table>\n")
+	case formatYAML:
+		// quoted scalars are valid YAML, no need for a YAML library
+		if len(records) == 0 {
+			fmt.Fprintln(&b, "[]")
+		}
+		for _, record := range records {
+			for n, value := range record.values() {
+				prefix := "  "
+				if n == 0 {
+					prefix = "- "
+				}
+				fmt.Fprintf(&b, "%s%s: %s\n", prefix, scheduleRecordColumns[n], strconv.Quote(value))
+			}
+		}
+	default:
+		return nil, errors.Errorf("Unknown format '%s'", format)
+	}
+	return b.Bytes(), nil
+}
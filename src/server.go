@@ -0,0 +1,129 @@
+package src
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// HTTPResponse - result of read-only request (calendar feeds, API), shared by HTTP and Lambda entry points
+type HTTPResponse struct {
+	Status int
+	Body   []byte
+}
+
+// SlackResponse - result of Slack request handling, Task (if any) should be
+// performed after response is sent as Slack expects reply within 3 seconds
+type SlackResponse struct {
+	Status int
+	Body   []byte
+	Task   func()
+}
+
+// HandleSlackRequest - verifies and handles Slack request (event, slash command or interaction), shared by HTTP and Lambda entry points
+func HandleSlackRequest(ctx *RuntimeContext, header http.Header, body []byte) *SlackResponse {
+	verifier, err := slack.NewSecretsVerifier(header, ctx.SlackSigningSecret)
+	if err == nil {
+		_, err = verifier.Write(body)
+	}
+	if err == nil {
+		err = verifier.Ensure()
+	}
+	if err != nil {
+		logError(ctx, "", err, "Rejected Slack request")
+		return &SlackResponse{Status: http.StatusUnauthorized}
+	}
+
+	// events are handled on first delivery only, retries come when handling took too long
+	if header.Get("X-Slack-Retry-Num") != "" {
+		return &SlackResponse{Status: http.StatusOK}
+	}
+
+	// slash commands and interactions are form encoded, events are JSON
+	if strings.HasPrefix(header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return &SlackResponse{Status: http.StatusBadRequest}
+		}
+		if payload := form.Get("payload"); payload != "" {
+			var callback slack.InteractionCallback
+			err = json.Unmarshal([]byte(payload), &callback)
+			if err != nil {
+				logError(ctx, "", err, "Unable to parse Slack interaction")
+				return &SlackResponse{Status: http.StatusBadRequest}
+			}
+			return &SlackResponse{Status: http.StatusOK, Task: handleInteraction(ctx, callback)}
+		}
+		command := slack.SlashCommand{
+			Command:     form.Get("command"),
+			Text:        form.Get("text"),
+			UserID:      form.Get("user_id"),
+			ChannelID:   form.Get("channel_id"),
+			ResponseURL: form.Get("response_url"),
+			TriggerID:   form.Get("trigger_id"),
+		}
+		return &SlackResponse{Status: http.StatusOK, Task: handleSlashCommand(ctx, command)}
+	}
+
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		logError(ctx, "", err, "Unable to parse Slack event")
+		return &SlackResponse{Status: http.StatusBadRequest}
+	}
+
+	if event.Type == slackevents.URLVerification {
+		verification, ok := event.Data.(*slackevents.EventsAPIURLVerificationEvent)
+		if !ok {
+			return &SlackResponse{Status: http.StatusBadRequest}
+		}
+		response, _ := json.Marshal(slackevents.ChallengeResponse{Challenge: verification.Challenge})
+		return &SlackResponse{Status: http.StatusOK, Body: response}
+	}
+
+	return &SlackResponse{Status: http.StatusOK, Task: handleSlackEvent(ctx, event)}
+}
+
+func slackHandler(ctx *RuntimeContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		response := HandleSlackRequest(ctx, r.Header, body)
+		if response.Body != nil {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(response.Status)
+		w.Write(response.Body)
+		if response.Task != nil {
+			go response.Task()
+		}
+	}
+}
+
+// Serve - runs HTTP server handling Slack events, slash commands, interactions and calendar feeds
+func Serve(ctx *RuntimeContext, addr string) error {
+	mux := http.NewServeMux()
+	if ctx.SlackSigningSecret != "" {
+		mux.HandleFunc("/slack/events", slackHandler(ctx))
+		mux.HandleFunc("/slack/commands", slackHandler(ctx))
+		mux.HandleFunc("/slack/interactivity", slackHandler(ctx))
+	} else {
+		logWarn(ctx, "", "Slack signing secret is missing, Slack requests will not be handled")
+	}
+	if ctx.ICalToken != "" {
+		mux.HandleFunc("/ical/", icalHandler(ctx))
+	} else {
+		logWarn(ctx, "", "iCal token is missing, calendar feeds will not be served")
+	}
+	mux.HandleFunc("/metrics", metricsHandler(ctx))
+	logInfo(ctx, "", "Listening on %s", addr)
+	return errors.Wrap(http.ListenAndServe(addr, mux), 0)
+}
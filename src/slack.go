@@ -2,7 +2,6 @@ package src
 
 import (
 	"fmt"
-	"log"
 	"math"
 	"strings"
 
@@ -11,23 +10,23 @@ import (
 	"github.com/slack-go/slack"
 )
 
-func assignUsersToUserGroups(ctx *RuntimeContext, names []NameGroup, cfg *AssignmentsConfig) error {
-	userIds := make([]string, 0, len(names))
+func assignUsersToUserGroups(ctx *RuntimeContext, cfg *AssignmentsConfig, day *assignmentDay) error {
+	userIds := make([]string, 0, len(day.Current))
 
-	fmt.Println("Assigning to group", cfg.GroupName)
+	logInfo(ctx, cfg.GroupName, "Assigning")
 
-	for _, name := range names {
-		user := matchUserToName(ctx, name.Name)
+	unmatched := 0
+	for _, name := range day.Current {
+		user := matchUserToNameGroup(ctx, name)
 		if user == nil {
-			fmt.Printf("Unable to match spreadsheet name '%s' to slack user\n", name.Name)
+			logWarn(ctx, cfg.GroupName, "Unable to match spreadsheet name '%s' to slack user", name.Name)
+			unmatched++
 			continue
 		}
-		fmt.Printf("%s -> %s (@%s)\n", name.Name, user.RealName, user.Name)
+		logInfo(ctx, cfg.GroupName, "%s -> %s (@%s)", name.Name, user.RealName, user.Name)
 		userIds = append(userIds, user.ID)
-		if cfg.NotifyUsers {
-			notifyUserInGroup(ctx, user, cfg)
-		}
 	}
+	ctx.metrics.set(metricUnmatchedNames, map[string]string{"group": cfg.GroupName}, float64(unmatched))
 
 	targetGroup := matchGroupToName(ctx, cfg.GroupName)
 	if targetGroup == nil {
@@ -39,7 +38,24 @@ func assignUsersToUserGroups(ctx *RuntimeContext, names []NameGroup, cfg *Assign
 	return err
 }
 
-func notifyUserInGroup(ctx *RuntimeContext, user *slack.User, cfg *AssignmentsConfig) {
+func notifyUserInGroup(ctx *RuntimeContext, user *slack.User, name NameGroup, cfg *AssignmentsConfig, day *assignmentDay) {
+	blocks := []slack.Block{sectionBlockFor(
+		fmt.Sprintf("Hi there %s, a quick reminder for you: you have been assigned for *%s* group today!", user.RealName, cfg.GroupName),
+	)}
+
+	if cfg.Templates != nil {
+		data := templateDataForDay(ctx, cfg, day)
+		person := toTemplatePerson(ctx, name)
+		data.Person = &person
+		data.Role = name.Group
+		templateBlocks, err := renderMessageBlocks("directMessage", cfg.Templates.DirectMessage, cfg.Templates.DirectMessageBlocks, data)
+		if err != nil {
+			logError(ctx, cfg.GroupName, err, "Unable to render direct message template")
+		} else if templateBlocks != nil {
+			blocks = templateBlocks
+		}
+	}
+
 	channel, _, _, err := ctx.slack.OpenConversation(&slack.OpenConversationParameters{
 		Users: []string{user.ID},
 	})
@@ -47,12 +63,10 @@ func notifyUserInGroup(ctx *RuntimeContext, user *slack.User, cfg *AssignmentsCo
 	if err == nil {
 		ctx.slack.SendMessage(
 			channel.ID,
-			slack.MsgOptionBlocks(sectionBlockFor(
-				fmt.Sprintf("Hi there %s, a quick reminder for you: you have been assigned for *%s* group today!", user.RealName, cfg.GroupName),
-			)),
+			slack.MsgOptionBlocks(blocks...),
 		)
 	} else {
-		log.Println("Unable to notify", user.RealName)
+		logWarn(ctx, "", "Unable to notify %s", user.RealName)
 	}
 }
 
@@ -71,11 +85,10 @@ func contextBlockFor(text1, text2 string) slack.Block {
 // VerifySlackNames -
 func VerifySlackNames(ctx *RuntimeContext) {
 	for _, cfg := range ctx.Configs {
-		fmt.Println("Verifying names for", cfg.GroupName)
+		logInfo(ctx, cfg.GroupName, "Verifying names")
 		names, err := getAllNames(ctx, cfg)
 		if err != nil {
-			log.Println(Stack(err))
-			log.Println("Unable to load names for", cfg.GroupName)
+			logError(ctx, cfg.GroupName, err, "Unable to load names")
 			continue
 		}
 		good := 0
@@ -83,34 +96,24 @@ func VerifySlackNames(ctx *RuntimeContext) {
 		bad := 0
 		for _, nameAndPos := range names {
 			user := matchUserToName(ctx, nameAndPos.name)
+			position := fmt.Sprintf("%s:%d", colNoToName(nameAndPos.col), nameAndPos.row)
 			if user == nil {
-				fmt.Printf("[%s:%d] %s -> \033[0;31munable to match!\033[0m\n",
-					colNoToName(nameAndPos.col),
-					nameAndPos.row,
-					nameAndPos.name,
-				)
+				logWarn(ctx, cfg.GroupName, "[%s] %s -> unable to match", position, nameAndPos.name)
 				bad++
-			} else {
-				dist := levenshtein.ComputeDistance(nameAndPos.name, user.RealName)
-				matchQuality := 100.0 - math.Min(100.0, math.Round(100.0*float64(dist)/float64(len(nameAndPos.name))))
-				fmt.Printf("[%s:%d] %s -> %s (@%s), match: %.0f%%%s\n",
-					colNoToName(nameAndPos.col),
-					nameAndPos.row,
-					nameAndPos.name,
-					user.RealName,
-					user.Name,
-					matchQuality,
-					(func() string {
-						if matchQuality < 50 {
-							lq++
-							return " \033[0;31mwarning! low quality match\033[0m"
-						}
-						good++
-						return ""
-					})(),
-				)
+				continue
+			}
+			dist := levenshtein.ComputeDistance(nameAndPos.name, user.RealName)
+			matchQuality := 100.0 - math.Min(100.0, math.Round(100.0*float64(dist)/float64(len(nameAndPos.name))))
+			if matchQuality < 50 {
+				lq++
+				logWarn(ctx, cfg.GroupName, "[%s] %s -> %s (@%s), match: %.0f%%, low quality match",
+					position, nameAndPos.name, user.RealName, user.Name, matchQuality)
+				continue
 			}
+			good++
+			logInfo(ctx, cfg.GroupName, "[%s] %s -> %s (@%s), match: %.0f%%",
+				position, nameAndPos.name, user.RealName, user.Name, matchQuality)
 		}
-		fmt.Println(good, "matches,", lq, "low quality,", bad, "missing")
+		logInfo(ctx, cfg.GroupName, "%d matches, %d low quality, %d missing", good, lq, bad)
 	}
 }
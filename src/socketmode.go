@@ -0,0 +1,63 @@
+package src
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// RunSocketMode - receives Slack events, slash commands and interactions over websocket
+// (no public HTTP endpoint is needed), blocks until connection is closed
+func RunSocketMode(ctx *RuntimeContext) error {
+	if ctx.SlackAppAPIKey == "" {
+		return errors.Errorf("Slack app-level token is required for Socket Mode")
+	}
+	api := slack.New(ctx.SlackBotAPIKey, slack.OptionAppLevelToken(ctx.SlackAppAPIKey))
+	client := socketmode.New(api)
+
+	go func() {
+		for evt := range client.Events {
+			var task func()
+			switch evt.Type {
+			case socketmode.EventTypeConnecting:
+				logInfo(ctx, "", "Connecting to Slack with Socket Mode")
+			case socketmode.EventTypeConnectionError:
+				logWarn(ctx, "", "Socket Mode connection failed, retrying")
+			case socketmode.EventTypeConnected:
+				logInfo(ctx, "", "Connected to Slack with Socket Mode")
+			// envelopes are acknowledged even when payload is unexpected, otherwise Slack retries them
+			case socketmode.EventTypeEventsAPI:
+				client.Ack(*evt.Request)
+				event, ok := evt.Data.(slackevents.EventsAPIEvent)
+				if !ok {
+					continue
+				}
+				task = handleSlackEvent(ctx, event)
+			case socketmode.EventTypeSlashCommand:
+				client.Ack(*evt.Request)
+				command, ok := evt.Data.(slack.SlashCommand)
+				if !ok {
+					continue
+				}
+				task = handleSlashCommand(ctx, command)
+			case socketmode.EventTypeInteractive:
+				client.Ack(*evt.Request)
+				callback, ok := evt.Data.(slack.InteractionCallback)
+				if !ok {
+					continue
+				}
+				task = handleInteraction(ctx, callback)
+			}
+			if task != nil {
+				go task()
+			}
+		}
+	}()
+
+	err := client.Run()
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package src
 
 import (
+	"strings"
 	"time"
 
 	"github.com/go-errors/errors"
@@ -20,6 +21,10 @@ func getNamesForDate(cfg *AssignmentsConfig, results *sheets.ValueRange, date ti
 		hasGroupRows = true
 		groups = results.Values[cfg.groupsRowNum]
 	}
+	var emails []interface{}
+	if cfg.EmailsRow > 0 && cfg.emailsRowNum >= 0 && cfg.emailsRowNum < len(results.Values) {
+		emails = results.Values[cfg.emailsRowNum]
+	}
 
 	for _, row := range results.Values {
 		if cfg.datesColNum < 0 || cfg.datesColNum >= len(row) {
@@ -37,9 +42,14 @@ func getNamesForDate(cfg *AssignmentsConfig, results *sheets.ValueRange, date ti
 							if hasGroupRows {
 								group, _ = groups[colN].(string)
 							}
+							email := ""
+							if colN < len(emails) {
+								email, _ = emails[colN].(string)
+							}
 							nameGroup := NameGroup{
 								Name:  cleanUpName(name),
 								Group: cleanUpName(group),
+								Email: strings.TrimSpace(email),
 							}
 							selected = append(selected, nameGroup)
 						}
@@ -52,30 +62,42 @@ func getNamesForDate(cfg *AssignmentsConfig, results *sheets.ValueRange, date ti
 }
 
 func getSpreadsheetData(ctx *RuntimeContext, cfg *AssignmentsConfig) (*sheets.ValueRange, error) {
-	return ctx.sheets.
+	cacheKey := cfg.SpreadsheetID + "|" + cfg.SelectRange
+	if ctx.sheetsCache != nil {
+		if values := ctx.sheetsCache.get(cacheKey); values != nil {
+			return values, nil
+		}
+	}
+	started := time.Now()
+	values, err := ctx.sheets.
 		Spreadsheets.
 		Values.
 		Get(cfg.SpreadsheetID, cfg.SelectRange).
 		DateTimeRenderOption("SERIAL_NUMBER").
 		ValueRenderOption("UNFORMATTED_VALUE").
 		Do()
-}
-
-func getCurrentAssignment(ctx *RuntimeContext, cfg *AssignmentsConfig, date time.Time) ([]NameGroup, error) {
-	result, err := getSpreadsheetData(ctx, cfg)
+	ctx.metrics.observe(metricSpreadsheetFetch, map[string]string{"group": cfg.GroupName}, time.Since(started))
 	if err != nil {
-		return nil, errors.Wrap(err, 0)
+		countBackendError(ctx, backendSheets)
 	}
-	names, err := getNamesForDate(cfg, result, date)
+	if err == nil && ctx.sheetsCache != nil {
+		ctx.sheetsCache.put(cacheKey, values)
+	}
+	return values, err
+}
+
+func getNamesWithOverlap(ctx *RuntimeContext, cfg *AssignmentsConfig, results *sheets.ValueRange, date time.Time) ([]NameGroup, error) {
+	names, err := getNamesForDate(cfg, results, date)
 	if err != nil {
 		return nil, err
 	}
 	if ctx.Overlap {
+		// overlap with next working day
 		overlapDate := date.AddDate(0, 0, 1)
-		if overlapDate.Weekday() == time.Saturday {
-			overlapDate = overlapDate.AddDate(0, 0, 2)
+		for i := 0; i < 6 && !isWorkingDay(cfg, overlapDate); i++ {
+			overlapDate = overlapDate.AddDate(0, 0, 1)
 		}
-		overlapNames, err := getNamesForDate(cfg, result, overlapDate)
+		overlapNames, err := getNamesForDate(cfg, results, overlapDate)
 		if err != nil {
 			return nil, err
 		}
@@ -89,7 +111,46 @@ func getCurrentAssignment(ctx *RuntimeContext, cfg *AssignmentsConfig, date time
 			}
 		}
 	}
-	return names, err
+	return names, nil
+}
+
+// assignmentDay holds assignment for given date along with closest non-empty
+// assignments before and after it (weekends and gaps are skipped)
+type assignmentDay struct {
+	Date     time.Time
+	Previous []NameGroup
+	Current  []NameGroup
+	Next     []NameGroup
+}
+
+const adjacentSearchDays = 7
+
+func getAssignmentDay(ctx *RuntimeContext, cfg *AssignmentsConfig, date time.Time) (*assignmentDay, error) {
+	if cfg.PagerDutyOnCall != nil {
+		return getOnCallAssignmentDay(ctx, cfg, date)
+	}
+	result, err := getSpreadsheetData(ctx, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	day := &assignmentDay{Date: date}
+	day.Current, err = getNamesWithOverlap(ctx, cfg, result, date)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i <= adjacentSearchDays && len(day.Previous) == 0; i++ {
+		day.Previous, err = getNamesWithOverlap(ctx, cfg, result, date.AddDate(0, 0, -i))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := 1; i <= adjacentSearchDays && len(day.Next) == 0; i++ {
+		day.Next, err = getNamesWithOverlap(ctx, cfg, result, date.AddDate(0, 0, i))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return day, nil
 }
 
 func getDailyAssignmentScheduleForDateRange(
@@ -104,29 +165,10 @@ func getDailyAssignmentScheduleForDateRange(
 		return nil, errors.Wrap(err, 0)
 	}
 	for dayDate := startDate; dayDate.Before(endDate); dayDate = dayDate.AddDate(0, 0, 1) {
-		names, err := getNamesForDate(cfg, result, dayDate)
+		names, err := getNamesWithOverlap(ctx, cfg, result, dayDate)
 		if err != nil {
 			return nil, err
 		}
-		if ctx.Overlap {
-			overlapDate := dayDate.AddDate(0, 0, 1)
-			if overlapDate.Weekday() == time.Saturday {
-				overlapDate = overlapDate.AddDate(0, 0, 2)
-			}
-			overlapNames, err := getNamesForDate(cfg, result, overlapDate)
-			if err != nil {
-				return nil, err
-			}
-			uniqueMap := make(map[string]bool)
-			for n := range names {
-				uniqueMap[names[n].Name] = true
-			}
-			for n := range overlapNames {
-				if _, ok := uniqueMap[overlapNames[n].Name]; !ok {
-					names = append(names, overlapNames[n])
-				}
-			}
-		}
 		schedule = append(schedule, AssignmentsScheduleEntry{
 			Date:  dayDate,
 			Names: names,
@@ -0,0 +1,54 @@
+package src
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"google.golang.org/api/sheets/v4"
+)
+
+const defaultSpreadsheetCacheTTL = 5 * time.Minute
+
+// spreadsheetCache - spreadsheet ranges kept in memory by long running servers, so every
+// request does not hit Sheets API (and its quota)
+type spreadsheetCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]spreadsheetCacheEntry
+}
+
+type spreadsheetCacheEntry struct {
+	values    *sheets.ValueRange
+	fetchedAt time.Time
+}
+
+// EnableSpreadsheetCache - spreadsheet data is reused for spreadsheetCacheTTL (5 minutes by default)
+func EnableSpreadsheetCache(ctx *RuntimeContext) error {
+	ttl := defaultSpreadsheetCacheTTL
+	if ctx.SpreadsheetCacheTTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(ctx.SpreadsheetCacheTTL)
+		if err != nil {
+			return errors.Errorf("Invalid spreadsheetCacheTTL '%s'", ctx.SpreadsheetCacheTTL)
+		}
+	}
+	ctx.sheetsCache = &spreadsheetCache{ttl: ttl, entries: make(map[string]spreadsheetCacheEntry)}
+	return nil
+}
+
+func (c *spreadsheetCache) get(key string) *sheets.ValueRange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.fetchedAt) >= c.ttl {
+		return nil
+	}
+	return entry.values
+}
+
+func (c *spreadsheetCache) put(key string, values *sheets.ValueRange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = spreadsheetCacheEntry{values: values, fetchedAt: time.Now()}
+}
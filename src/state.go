@@ -0,0 +1,38 @@
+package src
+
+import (
+	"github.com/go-errors/errors"
+)
+
+// errNoStateStorage - state files (caches, history, synced events) cannot be stored, eg. in Lambda
+// without state bucket, as SSM parameters are too small for them
+var errNoStateStorage = errors.Errorf("No state storage configured")
+
+// SetStateStorage - storage of state files, IO strategy of the context by default, nil disables state files
+func SetStateStorage(ctx *RuntimeContext, io IOStrategy) {
+	ctx.state = io
+	ctx.stateSet = true
+}
+
+func stateStorage(ctx *RuntimeContext) IOStrategy {
+	if ctx.stateSet {
+		return ctx.state
+	}
+	return ctx.io
+}
+
+func loadState(ctx *RuntimeContext, name string) ([]byte, error) {
+	io := stateStorage(ctx)
+	if io == nil {
+		return nil, errNoStateStorage
+	}
+	return io.LoadBytes(name)
+}
+
+func saveState(ctx *RuntimeContext, name string, data []byte) error {
+	io := stateStorage(ctx)
+	if io == nil {
+		return errNoStateStorage
+	}
+	return io.SaveBytes(name, data)
+}
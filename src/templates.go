@@ -0,0 +1,200 @@
+package src
+
+import (
+	"encoding/json"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/slack-go/slack"
+)
+
+// TemplatePerson -
+type TemplatePerson struct {
+	Name      string
+	Role      string
+	SlackID   string
+	SlackName string
+	RealName  string
+	Mention   string
+}
+
+// TemplateDay -
+type TemplateDay struct {
+	Date           time.Time
+	People         []TemplatePerson
+	SameAsPrevious bool
+}
+
+// TemplateHandoff -
+type TemplateHandoff struct {
+	Role     string
+	Outgoing []TemplatePerson
+	Incoming []TemplatePerson
+}
+
+// TemplateData - variables available in per-config templates
+type TemplateData struct {
+	Group     string
+	Title     string
+	Date      time.Time
+	Role      string
+	Person    *TemplatePerson
+	People    []TemplatePerson
+	Previous  []TemplatePerson
+	Next      []TemplatePerson
+	Days      []TemplateDay
+	Handoffs  []TemplateHandoff
+	Checklist []string
+}
+
+var templateFuncs = template.FuncMap{
+	"date": func(t time.Time) string {
+		return t.Format(format)
+	},
+	"formatDate": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	"mentions": joinMentions,
+	"names": func(people []TemplatePerson) string {
+		names := make([]string, len(people))
+		for n := range people {
+			names[n] = people[n].Name
+		}
+		return strings.Join(names, ", ")
+	},
+	// json escapes value so it can be safely embedded inside Block Kit JSON string
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := v.(string); ok {
+			// only quotes enclosing string are removed, escaped ones inside are kept
+			return string(b[1 : len(b)-1]), nil
+		}
+		return string(b), nil
+	},
+}
+
+func joinMentions(people []TemplatePerson) string {
+	mentions := make([]string, len(people))
+	for n := range people {
+		mentions[n] = people[n].Mention
+	}
+	return strings.Join(mentions, ", ")
+}
+
+func renderTemplate(name, text string, data *TemplateData) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	var b strings.Builder
+	err = tmpl.Execute(&b, data)
+	if err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	return b.String(), nil
+}
+
+// renderBlocksTemplate renders Block Kit template, result should be either
+// array of blocks or object with "blocks" key (as copied from Block Kit Builder)
+func renderBlocksTemplate(name, text string, data *TemplateData) ([]slack.Block, error) {
+	rendered, err := renderTemplate(name, text, data)
+	if err != nil {
+		return nil, err
+	}
+	rendered = strings.TrimSpace(rendered)
+	var blocks slack.Blocks
+	if strings.HasPrefix(rendered, "{") {
+		var wrapper struct {
+			Blocks slack.Blocks `json:"blocks"`
+		}
+		err = json.Unmarshal([]byte(rendered), &wrapper)
+		blocks = wrapper.Blocks
+	} else {
+		err = json.Unmarshal([]byte(rendered), &blocks)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return blocks.BlockSet, nil
+}
+
+// renderMessageBlocks renders blocks template if present, text template as
+// single section otherwise; nil is returned if neither is configured
+func renderMessageBlocks(name, text, blocksText string, data *TemplateData) ([]slack.Block, error) {
+	if blocksText != "" {
+		return renderBlocksTemplate(name, blocksText, data)
+	}
+	if text != "" {
+		rendered, err := renderTemplate(name, text, data)
+		if err != nil {
+			return nil, err
+		}
+		return []slack.Block{sectionBlockFor(rendered)}, nil
+	}
+	return nil, nil
+}
+
+func toTemplatePerson(ctx *RuntimeContext, name NameGroup) TemplatePerson {
+	person := TemplatePerson{
+		Name:    name.Name,
+		Role:    name.Group,
+		Mention: name.Name,
+	}
+	if user := matchUserToNameGroup(ctx, name); user != nil {
+		person.SlackID = user.ID
+		person.SlackName = user.Name
+		person.RealName = user.RealName
+		person.Mention = "<@" + user.ID + ">"
+	}
+	return person
+}
+
+func toTemplatePeople(ctx *RuntimeContext, names []NameGroup) []TemplatePerson {
+	people := make([]TemplatePerson, len(names))
+	for n := range names {
+		people[n] = toTemplatePerson(ctx, names[n])
+	}
+	return people
+}
+
+func templateDataForDay(ctx *RuntimeContext, cfg *AssignmentsConfig, day *assignmentDay) *TemplateData {
+	return &TemplateData{
+		Group:    cfg.GroupName,
+		Date:     day.Date,
+		People:   toTemplatePeople(ctx, day.Current),
+		Previous: toTemplatePeople(ctx, day.Previous),
+		Next:     toTemplatePeople(ctx, day.Next),
+	}
+}
+
+func templateDataForSchedule(
+	ctx *RuntimeContext,
+	cfg *AssignmentsConfig,
+	schedule []AssignmentsScheduleEntry,
+	title string,
+) *TemplateData {
+	data := &TemplateData{
+		Group: cfg.GroupName,
+		Title: title,
+		Days:  make([]TemplateDay, 0, len(schedule)),
+	}
+	if len(schedule) > 0 {
+		data.Date = schedule[0].Date
+	}
+	for _, entry := range schedule {
+		if len(entry.Names) == 0 && !isWorkingDay(cfg, entry.Date) {
+			continue
+		}
+		data.Days = append(data.Days, TemplateDay{
+			Date:           entry.Date,
+			People:         toTemplatePeople(ctx, entry.Names),
+			SameAsPrevious: len(entry.Names) == 0 && cfg.KeepWhenMissing,
+		})
+	}
+	return data
+}
@@ -1,13 +1,16 @@
 package src
 
 import (
-	"fmt"
+	"bufio"
+	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/PagerDuty/go-pagerduty"
 	"github.com/slack-go/slack"
+	"google.golang.org/api/calendar/v3"
 	"google.golang.org/api/sheets/v4"
 )
 
@@ -25,6 +28,9 @@ type PagerDutySlotAssignment struct {
 	User      string
 	StartUtc  string
 	DayOfWeek uint
+	Start     time.Time
+	Duration  time.Duration
+	Group     string
 }
 
 // PagerDutyTierAssignment -
@@ -38,32 +44,126 @@ type PagerDutyTierAssignment struct {
 type NameGroup struct {
 	Name  string
 	Group string
+	Email string
+	// Tier - escalation level of PagerDuty on-call people, 0 for spreadsheet ones
+	Tier uint
 }
 
 // PagerDutyConfig -
 type PagerDutyConfig struct {
-	Prefix   string   `json:"prefix"`
-	PolicyID string   `json:"policyID"`
-	Groups   []string `json:"groups"`
-	TierIDs  []string `json:"tierIDs"`
+	Prefix         string   `json:"prefix"`
+	PolicyID       string   `json:"policyID"`
+	Groups         []string `json:"groups"`
+	TierIDs        []string `json:"tierIDs"`
+	Mode           string   `json:"mode"`
+	Teams          []string `json:"teams"`
+	TimeZone       string   `json:"timeZone"`
+	ShiftStart     string   `json:"shiftStart"`
+	ShiftDuration  string   `json:"shiftDuration"`
+	WeekendShift   bool     `json:"weekendShift"`
+	Distribution   string   `json:"distribution"`
+	TargetsPerTier int      `json:"targetsPerTier"`
+}
+
+// TemplatesConfig - Go text/template sources, *Blocks variants should render Block Kit JSON
+type TemplatesConfig struct {
+	Schedule            string `json:"schedule"`
+	ScheduleBlocks      string `json:"scheduleBlocks"`
+	DirectMessage       string `json:"directMessage"`
+	DirectMessageBlocks string `json:"directMessageBlocks"`
+	Handoff             string `json:"handoff"`
+	HandoffBlocks       string `json:"handoffBlocks"`
+}
+
+// ReminderConfig - DM sent DaysBefore days ahead of shift start at given local time
+type ReminderConfig struct {
+	DaysBefore     int    `json:"daysBefore"`
+	At             string `json:"at"`
+	TimeZone       string `json:"timeZone"`
+	Template       string `json:"template"`
+	BlocksTemplate string `json:"blocksTemplate"`
+}
+
+// HandoffConfig - message posted when assignment changes, to channel or group DM
+type HandoffConfig struct {
+	Channel       string   `json:"channel"`
+	DirectMessage bool     `json:"directMessage"`
+	Checklist     []string `json:"checklist"`
+}
+
+// OpsgenieConfig - Opsgenie counterpart of PagerDutyConfig, one schedule per group (and backup slot)
+// with escalation rules pointing to them in order
+type OpsgenieConfig struct {
+	EscalationID  string   `json:"escalationID"`
+	Groups        []string `json:"groups"`
+	Prefix        string   `json:"prefix"`
+	OwnerTeam     string   `json:"ownerTeam"`
+	Mode          string   `json:"mode"`
+	TimeZone      string   `json:"timeZone"`
+	ShiftStart    string   `json:"shiftStart"`
+	ShiftDuration string   `json:"shiftDuration"`
+	WeekendShift  bool     `json:"weekendShift"`
+}
+
+// PagerDutyOnCallConfig - takes people from PagerDuty on-call instead of spreadsheet
+type PagerDutyOnCallConfig struct {
+	ScheduleIDs      []string `json:"scheduleIDs"`
+	PolicyID         string   `json:"policyID"`
+	EscalationLevels []uint   `json:"escalationLevels"`
+}
+
+// NotifierConfig - chat tool where group announces its schedule (slack, teams or webhook)
+type NotifierConfig struct {
+	Type    string            `json:"type"`
+	URL     string            `json:"url"`
+	Channel string            `json:"channel"`
+	Headers map[string]string `json:"headers"`
+	To      []string          `json:"to"`
+}
+
+// SMTPConfig - mail server used by email notifiers
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+// CalendarConfig - Google Calendar where assignments are mirrored as all day events
+type CalendarConfig struct {
+	CalendarID      string `json:"calendarID"`
+	Days            int    `json:"days"`
+	InviteAssignees bool   `json:"inviteAssignees"`
 }
 
 // AssignmentsConfig -
 type AssignmentsConfig struct {
-	PagerDuty       []*PagerDutyConfig `json:"pagerDuty"`
-	SelectRange     string             `json:"selectRange"`
-	GroupName       string             `json:"groupName"`
-	SpreadsheetID   string             `json:"spreadsheetID"`
-	DatesCol        string             `json:"datesCol"`
-	NotifyChannel   string             `json:"notifyChannel"`
-	AssignCharacter string             `json:"assignCharacter"`
-	NamesRow        int                `json:"namesRow"`
-	GroupsRow       int                `json:"groupsRow"`
+	Calendar        *CalendarConfig        `json:"calendar"`
+	Notifiers       []*NotifierConfig      `json:"notifiers"`
+	PagerDuty       []*PagerDutyConfig     `json:"pagerDuty"`
+	Opsgenie        []*OpsgenieConfig      `json:"opsgenie"`
+	Templates       *TemplatesConfig       `json:"templates"`
+	Reminders       []*ReminderConfig      `json:"reminders"`
+	Handoff         *HandoffConfig         `json:"handoff"`
+	PagerDutyOnCall *PagerDutyOnCallConfig `json:"pagerDutyOnCall"`
+	SelectRange     string                 `json:"selectRange"`
+	GroupName       string                 `json:"groupName"`
+	SpreadsheetID   string                 `json:"spreadsheetID"`
+	DatesCol        string                 `json:"datesCol"`
+	NotifyChannel   string                 `json:"notifyChannel"`
+	AssignCharacter string                 `json:"assignCharacter"`
+	NamesRow        int                    `json:"namesRow"`
+	GroupsRow       int                    `json:"groupsRow"`
+	EmailsRow       int                    `json:"emailsRow"`
+	WorkingDays     []string               `json:"workingDays"`
 	namesRowNum     int
 	groupsRowNum    int
+	emailsRowNum    int
 	datesColNum     int
 	rowOffset       int
 	colOffset       int
+	workingDays     []time.Weekday
 	KeepWhenMissing bool `json:"keepWhenMissing"`
 	NotifyUsers     bool `json:"notifyUsers"`
 }
@@ -77,25 +177,49 @@ type GoogleCredentials struct {
 
 // RuntimeContext -
 type RuntimeContext struct {
-	Configs           []*AssignmentsConfig `json:"configs"`
-	GoogleCredentials GoogleCredentials    `json:"googleCredentials"`
-	GoogleAPIKey      string               `json:"googleAPIKey"`
-	SlackBotAPIKey    string               `json:"slackBotAPIKey"`
-	SlackAccessAPIKey string               `json:"slackAccessAPIKey"`
-	PagerDutyToken    string               `json:"pagerDutyToken"`
-	FilterGroups      string
-	Verbose           bool
-	Overlap           bool
-
-	slack     *slack.Client
-	slackP    *slack.Client
-	sheets    *sheets.Service
-	groups    UserGroupList
-	users     UserList
-	pdUsers   PDUserList
-	channels  ChannelList
-	io        IOStrategy
-	pagerduty *pagerduty.Client
+	Configs               []*AssignmentsConfig `json:"configs"`
+	GoogleCredentials     GoogleCredentials    `json:"googleCredentials"`
+	GoogleAPIKey          string               `json:"googleAPIKey"`
+	SlackBotAPIKey        string               `json:"slackBotAPIKey"`
+	SlackAccessAPIKey     string               `json:"slackAccessAPIKey"`
+	PagerDutyToken        string               `json:"pagerDutyToken"`
+	PagerDutyDirectoryTTL string               `json:"pagerDutyDirectoryTTL"`
+	SlackSigningSecret    string               `json:"slackSigningSecret"`
+	OpsgenieAPIKey        string               `json:"opsgenieAPIKey"`
+	OpsgenieURL           string               `json:"opsgenieURL"`
+	SlackAppAPIKey        string               `json:"slackAppAPIKey"`
+	SlackAppHome          bool                 `json:"slackAppHome"`
+	SMTP                  *SMTPConfig          `json:"smtp"`
+	Identities            map[string]string    `json:"identities"`
+	ICalToken             string               `json:"icalToken"`
+	APIToken              string               `json:"apiToken"`
+	SpreadsheetCacheTTL   string               `json:"spreadsheetCacheTTL"`
+	FilterGroups          string
+	Verbose               bool
+	Overlap               bool
+	Seed                  int64
+	AssumeYes             bool
+	PlanOut               string
+	Format                string
+	Command               string
+
+	slack       *slack.Client
+	slackP      *slack.Client
+	sheets      *sheets.Service
+	calendar    *calendar.Service
+	sheetsCache *spreadsheetCache
+	metrics     *metricsRegistry
+	logger      *runLogger
+	state       IOStrategy
+	stateSet    bool
+	groups      UserGroupList
+	users       UserList
+	pdUsers     PDUserList
+	channels    ChannelList
+	io          IOStrategy
+	pagerduty   *pagerduty.Client
+	opsgenie    *opsgenieClient
+	ogUsers     []opsgenieUser
 }
 
 // AssignmentsScheduleEntry  -
@@ -151,9 +275,11 @@ func (a *CliIOStrategy) Save(name, value string) error {
 	return a.SaveBytes(name, []byte(value))
 }
 
-// Prompt -
+// Prompt - reads single line, empty line (just Enter) gives empty answer
 func (a *CliIOStrategy) Prompt() (string, error) {
-	var str string
-	_, err := fmt.Scan(&str)
-	return str, err
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimSpace(line), err
 }
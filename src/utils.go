@@ -3,7 +3,6 @@ package src
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"math"
 	"strings"
 	"time"
@@ -76,6 +75,47 @@ func dateEqual(date1, date2 time.Time) bool {
 	return y1 == y2 && m1 == m2 && d1 == d2
 }
 
+func isWeekend(date time.Time) bool {
+	return date.Weekday() == time.Sunday || date.Weekday() == time.Saturday
+}
+
+var defaultWorkingDays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+func parseWorkingDays(days []string) ([]time.Weekday, error) {
+	if len(days) == 0 {
+		return defaultWorkingDays, nil
+	}
+	workingDays := make([]time.Weekday, 0, len(days))
+	for _, day := range days {
+		found := false
+		for n, name := range daysOfWeek {
+			if strings.EqualFold(day, name) || strings.EqualFold(day, name[:3]) {
+				workingDays = append(workingDays, time.Weekday(n))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("Unknown working day '%s'", day)
+		}
+	}
+	return workingDays, nil
+}
+
+// isWorkingDay - days outside of working days are skipped when empty (and in PagerDuty)
+func isWorkingDay(cfg *AssignmentsConfig, date time.Time) bool {
+	workingDays := cfg.workingDays
+	if workingDays == nil {
+		workingDays = defaultWorkingDays
+	}
+	for _, day := range workingDays {
+		if date.Weekday() == day {
+			return true
+		}
+	}
+	return false
+}
+
 func cleanUpName(name string) string {
 	name = strings.ReplaceAll(name, "\n", " ")
 	name = strings.ReplaceAll(name, "  ", " ")
@@ -93,6 +133,9 @@ func matchGroupToName(ctx *RuntimeContext, name string) *slack.UserGroup {
 }
 
 func matchUserToName(ctx *RuntimeContext, name string) *slack.User {
+	if len(ctx.users) == 0 {
+		return nil
+	}
 	best := &ctx.users[0]
 	bestDist := 9999999
 	for n := range ctx.users {
@@ -105,14 +148,32 @@ func matchUserToName(ctx *RuntimeContext, name string) *slack.User {
 	return best
 }
 
-func matchPDUserToName(ctx *RuntimeContext, name string) *pagerduty.User {
-	best := &ctx.pdUsers[0]
+// matchUserToNameGroup - exact match by email when it is known (PagerDuty on-call), closest name otherwise
+// or when no Slack user has the email (eg. different address in PagerDuty)
+func matchUserToNameGroup(ctx *RuntimeContext, name NameGroup) *slack.User {
+	if name.Email != "" {
+		for n := range ctx.users {
+			if strings.EqualFold(ctx.users[n].Profile.Email, name.Email) {
+				return &ctx.users[n]
+			}
+		}
+	}
+	return matchUserToName(ctx, name.Name)
+}
+
+// matchPDUserToName - closest PagerDuty user by name, limited to teams (if any)
+func matchPDUserToName(ctx *RuntimeContext, name string, teams []string) *pagerduty.User {
+	users := pdUsersInTeams(ctx, teams)
+	if len(users) == 0 {
+		return nil
+	}
+	best := &users[0]
 	bestDist := 9999999
-	for n := range ctx.pdUsers {
-		dist := levenshtein.ComputeDistance(ctx.pdUsers[n].Name, name)
+	for n := range users {
+		dist := levenshtein.ComputeDistance(users[n].Name, name)
 		if dist < bestDist {
 			bestDist = dist
-			best = &ctx.pdUsers[n]
+			best = &users[n]
 		}
 	}
 	return best
@@ -128,18 +189,20 @@ func matchChannelToName(ctx *RuntimeContext, name string) *slack.Channel {
 }
 
 // CreateContext -
-func CreateContext(fileName string, io IOStrategy) *RuntimeContext {
+func CreateContext(fileName string, io IOStrategy) (*RuntimeContext, error) {
 	var runtimeContext RuntimeContext
 	runtimeContext.io = io
+	runtimeContext.metrics = newMetricsRegistry()
+	runtimeContext.logger = newRunLogger()
 	runtimeContext.Verbose = false
 	configFile, err := io.LoadBytes(fileName)
 	if err != nil {
-		log.Fatalln(Stack(errors.Wrap(err, 0)))
+		return nil, errors.Wrap(err, 0)
 	}
 
 	err = json.Unmarshal(configFile, &runtimeContext)
 	if err != nil {
-		log.Fatalln(Stack(errors.Wrap(err, 0)))
+		return nil, errors.Wrap(err, 0)
 	}
 
 	for n, cfg := range runtimeContext.Configs {
@@ -153,36 +216,42 @@ func CreateContext(fileName string, io IOStrategy) *RuntimeContext {
 		startRangeCol, startRangeRow := nameToColRow(ranges[0])
 		runtimeContext.Configs[n].namesRowNum = cfg.NamesRow - startRangeRow
 		runtimeContext.Configs[n].groupsRowNum = cfg.GroupsRow - startRangeRow
+		runtimeContext.Configs[n].emailsRowNum = cfg.EmailsRow - startRangeRow
 		runtimeContext.Configs[n].datesColNum = nameToColNo(cfg.DatesCol) - startRangeCol
 		runtimeContext.Configs[n].colOffset = startRangeCol
 		runtimeContext.Configs[n].rowOffset = startRangeRow
+		runtimeContext.Configs[n].workingDays, err = parseWorkingDays(cfg.WorkingDays)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return &runtimeContext
+	return &runtimeContext, nil
 }
 
 // LoadSheets -
-func LoadSheets(ctx *RuntimeContext) {
+func LoadSheets(ctx *RuntimeContext) error {
 	var err error
 	ctx.sheets, err = getSheets(ctx)
 	if err != nil {
-		log.Fatalln(Stack(errors.Wrap(err, 0)))
+		return errors.Wrap(err, 0)
 	}
+	return nil
 }
 
 // LoadSlack -
-func LoadSlack(ctx *RuntimeContext) {
+func LoadSlack(ctx *RuntimeContext) error {
 	var err error
 	ctx.slack = slack.New(ctx.SlackBotAPIKey, slack.OptionDebug(false))
 	ctx.slackP = slack.New(ctx.SlackAccessAPIKey, slack.OptionDebug(false))
 
 	ctx.groups, err = ctx.slack.GetUserGroups()
 	if err != nil {
-		log.Fatalln(Stack(errors.Wrap(err, 0)))
+		return errors.Wrap(err, 0)
 	}
 
 	ctx.users, err = ctx.slack.GetUsers()
 	if err != nil {
-		log.Fatalln(Stack(errors.Wrap(err, 0)))
+		return errors.Wrap(err, 0)
 	}
 
 	ctx.channels = make([]slack.Channel, 0)
@@ -194,7 +263,7 @@ func LoadSlack(ctx *RuntimeContext) {
 			Types:           []string{"public_channel", "private_channel"},
 		})
 		if err != nil {
-			log.Fatalln(Stack(errors.Wrap(err, 0)))
+			return errors.Wrap(err, 0)
 		}
 		ctx.channels = append(ctx.channels, channels...)
 		if nextCursor != "" {
@@ -203,18 +272,48 @@ func LoadSlack(ctx *RuntimeContext) {
 			break
 		}
 	}
+	return nil
 }
 
 // LoadPagerduty -
-func LoadPagerduty(ctx *RuntimeContext) {
+func LoadPagerduty(ctx *RuntimeContext) error {
 	ctx.pagerduty = pagerduty.NewClient(ctx.PagerDutyToken)
 
-	var opts pagerduty.ListUsersOptions
-	opts.Total = true
-	opts.Limit = 1000
-	users, err := ctx.pagerduty.ListUsers(opts)
+	var err error
+	ctx.pdUsers, err = loadPagerDutyDirectory(ctx)
+	return err
+}
+
+// LoadUserDirectories - loads only Slack users and PagerDuty users (when pagerDutyToken is configured),
+// enough to resolve IDs of people in schedule records
+func LoadUserDirectories(ctx *RuntimeContext) error {
+	var err error
+	ctx.slack = slack.New(ctx.SlackBotAPIKey, slack.OptionDebug(false))
+	ctx.users, err = ctx.slack.GetUsers()
 	if err != nil {
-		log.Fatalln(Stack(errors.Wrap(err, 0)))
+		return errors.Wrap(err, 0)
 	}
-	ctx.pdUsers = users.Users
+	if ctx.PagerDutyToken == "" {
+		return nil
+	}
+	return LoadPagerduty(ctx)
+}
+
+// LoadPagerDutyOnCall - loads PagerDuty only when some group takes people on call from it
+func LoadPagerDutyOnCall(ctx *RuntimeContext) error {
+	if !UsesPagerDutyOnCall(ctx) {
+		return nil
+	}
+	return LoadPagerduty(ctx)
+}
+
+// Load - runs loaders in order, stops at the first failing one
+func Load(ctx *RuntimeContext, loaders ...func(*RuntimeContext) error) error {
+	for _, loader := range loaders {
+		err := loader(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
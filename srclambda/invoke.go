@@ -0,0 +1,31 @@
+package srclambda
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awslambda "github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/go-errors/errors"
+)
+
+var lambdac *awslambda.Lambda
+
+func init() {
+	sess := session.Must(session.NewSession())
+	lambdac = awslambda.New(sess)
+}
+
+// InvokeSelfAsync - invokes running function again with given payload without waiting for result,
+// lets work continue after response is returned (function needs lambda:InvokeFunction on itself)
+func InvokeSelfAsync(payload []byte) error {
+	_, err := lambdac.Invoke(&awslambda.InvokeInput{
+		FunctionName:   aws.String(os.Getenv("AWS_LAMBDA_FUNCTION_NAME")),
+		InvocationType: aws.String(awslambda.InvocationTypeEvent),
+		Payload:        payload,
+	})
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package srclambda
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-errors/errors"
+)
+
+var s3c *s3.S3
+
+// contentTypes - types of generated files set explicitly, mime table of Lambda runtime may miss them
+var contentTypes = map[string]string{
+	".ics":  "text/calendar; charset=utf-8",
+	".html": "text/html; charset=utf-8",
+	".json": "application/json",
+}
+
+func init() {
+	sess := session.Must(session.NewSession())
+	s3c = s3.New(sess)
+}
+
+// S3IOStrategy - stores files as bucket objects, used for generated pages too large for SSM
+type S3IOStrategy struct {
+	Bucket    string
+	KeyPrefix string
+}
+
+// Load -
+func (a *S3IOStrategy) Load(name string) (string, error) {
+	b, err := a.LoadBytes(name)
+	return string(b), err
+}
+
+// Save -
+func (a *S3IOStrategy) Save(name, value string) error {
+	return a.SaveBytes(name, []byte(value))
+}
+
+// LoadBytes -
+func (a *S3IOStrategy) LoadBytes(name string) ([]byte, error) {
+	object, err := s3c.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(a.Bucket),
+		Key:    aws.String(a.KeyPrefix + name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+	return ioutil.ReadAll(object.Body)
+}
+
+// SaveBytes -
+func (a *S3IOStrategy) SaveBytes(name string, value []byte) error {
+	contentType, ok := contentTypes[path.Ext(name)]
+	if !ok {
+		contentType = mime.TypeByExtension(path.Ext(name))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	_, err := s3c.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(a.Bucket),
+		Key:         aws.String(a.KeyPrefix + name),
+		Body:        bytes.NewReader(value),
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+// Prompt -
+func (a *S3IOStrategy) Prompt() (string, error) {
+	return "", errors.Errorf("Unable to get user input from within AWS Lambda")
+}